@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"github.com/evolbioinf/biobox/util"
@@ -9,9 +10,42 @@ import (
 	"github.com/evolbioinf/pal"
 	"io"
 	"log"
+	"math"
+	"math/rand"
 	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
 )
 
+type significance struct {
+	scores    []float64
+	m, n      int
+	lambda, k float64
+	z         bool
+}
+type frugalAlignment struct {
+	q, s       *fasta.Sequence
+	mat        *pal.ScoreMatrix
+	gapO, gapE float64
+	ll         int
+	qa, sa     []byte
+	score      float64
+}
+type hirschberg struct {
+	q, s           []byte
+	mat            *pal.ScoreMatrix
+	g, h           float64
+	cc, dd, rr, ss []float64
+	qa, sa         []byte
+}
+type alignment interface {
+	RawAlignment() ([]byte, []byte)
+	Score() float64
+	String() string
+}
+
 var optV = flag.Bool("v", false, "version")
 var optL = flag.Bool("l", false, "local (default global)")
 var optO = flag.Bool("o", false, "overlap (default global)")
@@ -21,12 +55,358 @@ var optM = flag.String("m", "", "file containing score matrix")
 var optP = flag.Float64("p", -5, "gap opening")
 var optE = flag.Float64("e", -2, "gap extension")
 var optN = flag.Int("n", 1, "number of local alignments")
+var optC = flag.Int("c", 0, "number of shuffles for computing "+
+	"significance of local alignments (default no significance)")
+var optR = flag.Int("r", 0, "seed for random number generator "+
+	"(default internal)")
+var optZ = flag.Bool("z", false, "z-score instead of E-value "+
+	"and bit score")
+var optH = flag.Bool("H", false, "linear space (Hirschberg)")
+var optB = flag.Int("b", 0, "band width (default no band)")
 var optLL = flag.Int("L", fasta.DefaultLineLength, "line length")
 var optPP = flag.String("P", "", "print programming matrix (d|v|h|s|t)")
+var optT = flag.Bool("t", false, "tabular output")
+var optF = flag.Bool("f", false, "FASTA output of gapped pair")
 
+func (g *significance) columns(s float64) string {
+	if g == nil {
+		return ""
+	}
+	if g.z {
+		return fmt.Sprintf("\t%.2f", util.ZScore(s, g.scores))
+	}
+	e := util.EValue(s, g.lambda, g.k, g.m, g.n)
+	b := util.BitScore(s, g.lambda, g.k)
+	return fmt.Sprintf("\t%.3g\t%.1f", e, b)
+}
+func (g *significance) annotate(a string, s float64) string {
+	if g == nil {
+		return a
+	}
+	var l string
+	if g.z {
+		l = fmt.Sprintf("z-score %.2f\n", util.ZScore(s, g.scores))
+	} else {
+		e := util.EValue(s, g.lambda, g.k, g.m, g.n)
+		b := util.BitScore(s, g.lambda, g.k)
+		l = fmt.Sprintf("E-value %.3g\nBits    %.1f\n", e, b)
+	}
+	i := strings.Index(a, "\nErrors")
+	if i < 0 {
+		return l + a
+	}
+	return a[:i+1] + l + a[i+1:]
+}
+func (a *frugalAlignment) RawAlignment() ([]byte, []byte) {
+	return a.qa, a.sa
+}
+func (a *frugalAlignment) Score() float64 {
+	return a.score
+}
+func (a *frugalAlignment) SetLineLength(l int) {
+	if l > 0 {
+		a.ll = l
+	}
+}
+func (a *frugalAlignment) alignBanded(w int) {
+	q := a.q.Data()
+	s := a.s.Data()
+	m := len(q)
+	n := len(s)
+	lo := -w
+	hi := w
+	if n < m {
+		lo += n - m
+	} else {
+		hi += n - m
+	}
+	nw := hi - lo + 1
+	inf := math.Inf(-1)
+	pm := make([]float64, nw)
+	px := make([]float64, nw)
+	py := make([]float64, nw)
+	cm := make([]float64, nw)
+	cx := make([]float64, nw)
+	cy := make([]float64, nw)
+	tb := make([][]byte, m+1)
+	for i := 0; i <= m; i++ {
+		tb[i] = make([]byte, nw)
+		for k := 0; k < nw; k++ {
+			cm[k], cx[k], cy[k] = inf, inf, inf
+			j := i + lo + k
+			if j < 0 || j > n {
+				continue
+			}
+			if i == 0 && j == 0 {
+				cm[k] = 0
+				continue
+			}
+			var t byte
+			if i > 0 && j > 0 {
+				v, p := max3(pm[k], px[k], py[k])
+				cm[k] = v + a.mat.Score(q[i-1], s[j-1])
+				t |= p
+			}
+			if i > 0 && k+1 < nw {
+				v, p := max3(pm[k+1]+a.gapO, px[k+1]+a.gapE,
+					py[k+1]+a.gapO)
+				cx[k] = v
+				t |= p << 2
+			}
+			if j > 0 && k > 0 {
+				v, p := max3(cm[k-1]+a.gapO, cx[k-1]+a.gapO,
+					cy[k-1]+a.gapE)
+				cy[k] = v
+				t |= p << 4
+			}
+			tb[i][k] = t
+		}
+		pm, cm = cm, pm
+		px, cx = cx, px
+		py, cy = cy, py
+	}
+	k := n - m - lo
+	_, st := max3(pm[k], px[k], py[k])
+	i := m
+	j := n
+	for i > 0 || j > 0 {
+		t := tb[i][j-i-lo]
+		if st == 0 {
+			a.qa = append(a.qa, q[i-1])
+			a.sa = append(a.sa, s[j-1])
+			st = t & 3
+			i--
+			j--
+		} else if st == 1 {
+			a.qa = append(a.qa, q[i-1])
+			a.sa = append(a.sa, '-')
+			st = t >> 2 & 3
+			i--
+		} else {
+			a.qa = append(a.qa, '-')
+			a.sa = append(a.sa, s[j-1])
+			st = t >> 4 & 3
+			j--
+		}
+	}
+	reverse(a.qa)
+	reverse(a.sa)
+	a.score = a.rescore()
+}
+func (a *frugalAlignment) rescore() float64 {
+	score := 0.0
+	var prev byte
+	for i := range a.qa {
+		c := byte('M')
+		if a.qa[i] == '-' {
+			c = 'D'
+		} else if a.sa[i] == '-' {
+			c = 'I'
+		}
+		if c == 'M' {
+			score += a.mat.Score(a.qa[i], a.sa[i])
+		} else if c == prev {
+			score += a.gapE
+		} else {
+			score += a.gapO
+		}
+		prev = c
+	}
+	return score
+}
+func (a *frugalAlignment) alignLinear() {
+	h := new(hirschberg)
+	h.q = a.q.Data()
+	h.s = a.s.Data()
+	h.mat = a.mat
+	h.g = a.gapO - a.gapE
+	h.h = a.gapE
+	n := len(h.s)
+	h.cc = make([]float64, n+1)
+	h.dd = make([]float64, n+1)
+	h.rr = make([]float64, n+1)
+	h.ss = make([]float64, n+1)
+	h.align(0, 0, len(h.q), n, h.g, h.g)
+	a.qa = h.qa
+	a.sa = h.sa
+	a.score = a.rescore()
+}
+func (h *hirschberg) align(i0, j0, m, n int, tb, te float64) {
+	if n == 0 {
+		h.del(i0, m)
+		return
+	}
+	if m == 0 {
+		h.ins(j0, n)
+		return
+	}
+	if m == 1 {
+		best := math.Max(tb, te) + h.h + h.gap(n)
+		bj := 0
+		for j := 1; j <= n; j++ {
+			c := h.gap(j-1) + h.mat.Score(h.q[i0], h.s[j0+j-1]) +
+				h.gap(n-j)
+			if c > best {
+				best = c
+				bj = j
+			}
+		}
+		if bj == 0 && tb >= te {
+			h.del(i0, 1)
+			h.ins(j0, n)
+		} else if bj == 0 {
+			h.ins(j0, n)
+			h.del(i0, 1)
+		} else {
+			h.ins(j0, bj-1)
+			h.qa = append(h.qa, h.q[i0])
+			h.sa = append(h.sa, h.s[j0+bj-1])
+			h.ins(j0+bj, n-bj)
+		}
+		return
+	}
+	mid := m / 2
+	h.pass(i0, j0, mid, n, tb, h.cc, h.dd, false)
+	h.pass(i0+mid, j0, m-mid, n, te, h.rr, h.ss, true)
+	best := math.Inf(-1)
+	jm := 0
+	inGap := false
+	for j := 0; j <= n; j++ {
+		c := h.cc[j] + h.rr[n-j]
+		if c > best {
+			best = c
+			jm = j
+			inGap = false
+		}
+		c = h.dd[j] + h.ss[n-j] - h.g
+		if c > best {
+			best = c
+			jm = j
+			inGap = true
+		}
+	}
+	if !inGap {
+		h.align(i0, j0, mid, jm, tb, h.g)
+		h.align(i0+mid, j0+jm, m-mid, n-jm, h.g, te)
+	} else {
+		h.align(i0, j0, mid-1, jm, tb, 0)
+		h.del(i0+mid-1, 2)
+		h.align(i0+mid+1, j0+jm, m-mid-1, n-jm, 0, te)
+	}
+}
+func (h *hirschberg) del(i, k int) {
+	for l := 0; l < k; l++ {
+		h.qa = append(h.qa, h.q[i+l])
+		h.sa = append(h.sa, '-')
+	}
+}
+func (h *hirschberg) ins(j, k int) {
+	for l := 0; l < k; l++ {
+		h.qa = append(h.qa, '-')
+		h.sa = append(h.sa, h.s[j+l])
+	}
+}
+func (h *hirschberg) gap(k int) float64 {
+	if k <= 0 {
+		return 0
+	}
+	return h.g + h.h*float64(k)
+}
+func (h *hirschberg) pass(i0, j0, m, n int, t float64,
+	cc, dd []float64, rev bool) {
+	cc[0] = 0
+	x := h.g
+	for j := 1; j <= n; j++ {
+		x += h.h
+		cc[j] = x
+		dd[j] = x + h.g
+	}
+	x = t
+	for i := 1; i <= m; i++ {
+		qi := h.q[i0+i-1]
+		if rev {
+			qi = h.q[i0+m-i]
+		}
+		d := cc[0]
+		x += h.h
+		c := x
+		cc[0] = c
+		e := x + h.g
+		for j := 1; j <= n; j++ {
+			sj := h.s[j0+j-1]
+			if rev {
+				sj = h.s[j0+n-j]
+			}
+			e = math.Max(e, c+h.g) + h.h
+			f := math.Max(dd[j], cc[j]+h.g) + h.h
+			c = math.Max(math.Max(f, e), d+h.mat.Score(qi, sj))
+			d = cc[j]
+			cc[j] = c
+			dd[j] = f
+		}
+	}
+	dd[0] = cc[0]
+}
+func (a *frugalAlignment) String() string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 1, 0, 1, ' ', 0)
+	fmt.Fprintf(w, "Query\t%s\t(%d residues)\n", a.q.Header(),
+		len(a.q.Data()))
+	fmt.Fprintf(w, "Subject\t%s\t(%d residues)\n", a.s.Header(),
+		len(a.s.Data()))
+	fmt.Fprintf(w, "Score\t%g\n", a.score)
+	gaps := 0
+	mismatches := 0
+	for i, c := range a.qa {
+		if c == '-' || a.sa[i] == '-' {
+			gaps++
+		} else if c != a.sa[i] {
+			mismatches++
+		}
+	}
+	fmt.Fprintf(w, "Errors\t%d (%d %s, %d %s)\n", gaps+mismatches,
+		gaps, plural("gap", gaps), mismatches,
+		plural("mismatch", mismatches))
+	w.Flush()
+	qs, ss := 0, 0
+	for i := 0; i < len(a.qa); i += a.ll {
+		end := i + a.ll
+		if end > len(a.qa) {
+			end = len(a.qa)
+		}
+		qb := a.qa[i:end]
+		sb := a.sa[i:end]
+		match := make([]byte, len(qb))
+		for j := range qb {
+			match[j] = ' '
+			if qb[j] != '-' && sb[j] != '-' {
+				if qb[j] == sb[j] {
+					match[j] = '|'
+				} else if a.mat.Score(qb[j], sb[j]) > 0 {
+					match[j] = ':'
+				}
+			}
+		}
+		fmt.Fprintf(w, "\n\nQuery\t%d\t%s\t%d\n",
+			first(qs, qb), qb, qs+numResidues(qb))
+		fmt.Fprintf(w, "\t\t%s\n", match)
+		fmt.Fprintf(w, "Subject\t%d\t%s\t%d\n",
+			first(ss, sb), sb, ss+numResidues(sb))
+		w.Flush()
+		qs += numResidues(qb)
+		ss += numResidues(sb)
+	}
+	buf.WriteString("//")
+	return buf.String()
+}
 func scan(r io.Reader, args ...interface{}) {
 	q := args[0].(*fasta.Sequence)
 	mat := args[1].(*pal.ScoreMatrix)
+	rn := args[2].(*rand.Rand)
+	numShuf := *optC
+	zScore := *optZ
+	linear := *optH
+	band := *optB
 	isLocal := *optL
 	isOverlap := *optO
 	gapO := *optP
@@ -37,18 +417,43 @@ func scan(r io.Reader, args ...interface{}) {
 		printMat = []byte(*optPP)[0]
 	}
 	ll := *optLL
+	var format byte
+	if *optT {
+		format = 't'
+	} else if *optF {
+		format = 'f'
+	}
 	sc := fasta.NewScanner(r)
 	for sc.ScanSequence() {
 		s := sc.Sequence()
 		if isLocal {
 			al := pal.NewLocalAlignment(q, s, mat, gapO, gapE)
 			al.SetLineLength(ll)
+			var sig *significance
+			if numShuf > 0 {
+				best := func(q, s *fasta.Sequence) float64 {
+					a := pal.NewLocalAlignment(q, s, mat, gapO, gapE)
+					a.Align()
+					return a.Score()
+				}
+				sig = new(significance)
+				sig.z = zScore
+				sig.scores = util.ShuffledScores(q, s, numShuf, rn, best)
+				sig.m = len(q.Data())
+				sig.n = len(s.Data())
+				if !sig.z {
+					sig.lambda, sig.k = util.KarlinAltschul(sig.scores,
+						sig.m, sig.n)
+				}
+			}
 			for i := 0; i < numAl && al.Align(); i++ {
 				if printMat != 0 {
 					s := al.PrintMatrix(printMat)
 					fmt.Printf(s)
+				} else if format != 0 {
+					printRecord(al, q, s, format, false, ll, sig)
 				} else {
-					fmt.Println(al)
+					fmt.Println(sig.annotate(al.String(), al.Score()))
 				}
 			}
 		} else if isOverlap {
@@ -58,22 +463,202 @@ func scan(r io.Reader, args ...interface{}) {
 			if printMat != 0 {
 				s := al.PrintMatrix(printMat)
 				fmt.Printf(s)
+			} else if format != 0 {
+				printRecord(al, q, s, format, true, ll, nil)
 			} else {
 				fmt.Println(al)
 			}
 		} else {
-			al := pal.NewGlobalAlignment(q, s, mat, gapO, gapE)
-			al.SetLineLength(ll)
-			al.Align()
-			if printMat != 0 {
-				s := al.PrintMatrix(printMat)
-				fmt.Printf(s)
+			if linear || band > 0 {
+				al := newFrugalAlignment(q, s, mat, gapO, gapE)
+				al.SetLineLength(ll)
+				if linear {
+					al.alignLinear()
+				} else {
+					al.alignBanded(band)
+				}
+				if format != 0 {
+					printRecord(al, q, s, format, false, ll, nil)
+				} else {
+					fmt.Println(al)
+				}
 			} else {
-				fmt.Println(al)
+				al := pal.NewGlobalAlignment(q, s, mat, gapO, gapE)
+				al.SetLineLength(ll)
+				al.Align()
+				if printMat != 0 {
+					s := al.PrintMatrix(printMat)
+					fmt.Printf(s)
+				} else if format != 0 {
+					printRecord(al, q, s, format, false, ll, nil)
+				} else {
+					fmt.Println(al)
+				}
 			}
 		}
 	}
 }
+func newFrugalAlignment(q, s *fasta.Sequence, mat *pal.ScoreMatrix,
+	gapO, gapE float64) *frugalAlignment {
+	a := new(frugalAlignment)
+	a.q = q
+	a.s = s
+	a.mat = mat
+	a.gapO = gapO
+	a.gapE = gapE
+	a.ll = fasta.DefaultLineLength
+	return a
+}
+func max3(a, b, c float64) (float64, byte) {
+	if a >= b && a >= c {
+		return a, 0
+	}
+	if b >= c {
+		return b, 1
+	}
+	return c, 2
+}
+func reverse(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
+func plural(noun string, n int) string {
+	if n == 1 {
+		return noun
+	}
+	if strings.HasSuffix(noun, "h") {
+		return noun + "es"
+	}
+	return noun + "s"
+}
+func first(before int, b []byte) int {
+	if numResidues(b) > 0 {
+		return before + 1
+	}
+	return before
+}
+func printRecord(al alignment, q, s *fasta.Sequence, format byte,
+	trim bool, ll int, sig *significance) {
+	qa, sa := al.RawAlignment()
+	qo, so := locate(al.String())
+	if trim {
+		b := 0
+		e := len(qa)
+		for b < e && (qa[b] == '-' || sa[b] == '-') {
+			b++
+		}
+		for e > b && (qa[e-1] == '-' || sa[e-1] == '-') {
+			e--
+		}
+		qo += numResidues(qa[:b])
+		so += numResidues(sa[:b])
+		qa = qa[b:e]
+		sa = sa[b:e]
+	}
+	qid := seqId(q.Header())
+	sid := seqId(s.Header())
+	ql := numResidues(qa)
+	sl := numResidues(sa)
+	if format == 't' {
+		id, gaps, cigar := summarize(qa, sa)
+		fmt.Printf("%s\t%s\t%d\t%d\t%d\t%d\t%g\t%.2f\t%d\t%s%s\n",
+			qid, sid, qo+1, qo+ql, so+1, so+sl, al.Score(),
+			id, gaps, cigar, sig.columns(al.Score()))
+	} else {
+		h := fmt.Sprintf("%s %d-%d", qid, qo+1, qo+ql)
+		seq := fasta.NewSequence(h, qa)
+		seq.SetLineLength(ll)
+		fmt.Println(seq)
+		h = fmt.Sprintf("%s %d-%d", sid, so+1, so+sl)
+		seq = fasta.NewSequence(h, sa)
+		seq.SetLineLength(ll)
+		fmt.Println(seq)
+	}
+}
+func locate(a string) (int, int) {
+	qo, so := -1, -1
+	inBlock := false
+	for _, l := range strings.Split(a, "\n") {
+		if l == "" {
+			inBlock = true
+			continue
+		}
+		if !inBlock {
+			continue
+		}
+		if qo < 0 && strings.HasPrefix(l, "Query") {
+			qo = preceding(l)
+		} else if so < 0 && strings.HasPrefix(l, "Subject") {
+			so = preceding(l)
+			break
+		}
+	}
+	if qo < 0 || so < 0 {
+		return 0, 0
+	}
+	return qo, so
+}
+func preceding(l string) int {
+	f := strings.Fields(l)
+	if len(f) != 4 {
+		log.Fatalf("couldn't locate alignment in %q", l)
+	}
+	e, err := strconv.Atoi(f[3])
+	if err != nil {
+		log.Fatal(err)
+	}
+	return e - numResidues([]byte(f[2]))
+}
+func numResidues(a []byte) int {
+	n := 0
+	for _, c := range a {
+		if c != '-' {
+			n++
+		}
+	}
+	return n
+}
+func seqId(h string) string {
+	f := strings.Fields(h)
+	if len(f) == 0 {
+		return ""
+	}
+	return f[0]
+}
+func summarize(qa, sa []byte) (float64, int, string) {
+	matches := 0
+	gaps := 0
+	var cigar []byte
+	var op byte
+	n := 0
+	for i := range qa {
+		c := byte('M')
+		if qa[i] == '-' {
+			c = 'D'
+			gaps++
+		} else if sa[i] == '-' {
+			c = 'I'
+			gaps++
+		} else if qa[i] == sa[i] {
+			matches++
+		}
+		if c != op && n > 0 {
+			cigar = append(cigar, fmt.Sprintf("%d%c", n, op)...)
+			n = 0
+		}
+		op = c
+		n++
+	}
+	if n > 0 {
+		cigar = append(cigar, fmt.Sprintf("%d%c", n, op)...)
+	}
+	id := 0.0
+	if len(qa) > 0 {
+		id = float64(matches) / float64(len(qa)) * 100.0
+	}
+	return id, gaps, string(cigar)
+}
 func main() {
 	util.PrepLog("al")
 	u := "al [-h] [options] query.fasta [subject files]"
@@ -103,6 +688,50 @@ func main() {
 	} else if *optPP == "s" {
 		(*optPP) = "v"
 	}
+	n := 0
+	if *optPP != "" {
+		n++
+	}
+	if *optT {
+		n++
+	}
+	if *optF {
+		n++
+	}
+	if n > 1 {
+		log.Fatal("please use only one of -P, -t, and -f")
+	}
+	if *optC > 0 && !*optL {
+		log.Fatal("significance is only computed " +
+			"for local alignments")
+	}
+	if *optZ && *optC < 1 {
+		log.Fatal("please set the number of shuffles " +
+			"for the z-score with -c")
+	}
+	if *optC > 0 && *optC < 100 {
+		fmt.Fprintf(os.Stderr, "al: %d shuffles give noisy "+
+			"significance estimates, use at least 100\n", *optC)
+	}
+	if *optB < 0 {
+		log.Fatal("please use a positive band width")
+	}
+	if *optH || *optB > 0 {
+		if *optH && *optB > 0 {
+			log.Fatal("please use only one of -H and -b")
+		}
+		if *optL || *optO {
+			log.Fatal("-H and -b only apply to global alignments")
+		}
+		if *optPP != "" {
+			log.Fatal("matrix printing is only " +
+				"available in full mode")
+		}
+		if *optH && *optP > *optE {
+			log.Fatal("in linear space, gap opening " +
+				"shouldn't exceed gap extension")
+		}
+	}
 	files := flag.Args()
 	if len(files) < 1 {
 		fmt.Fprintf(os.Stderr, "please give the name "+
@@ -123,6 +752,13 @@ func main() {
 		mat = pal.ReadScoreMatrix(f)
 		f.Close()
 	}
+	var rn *rand.Rand
+	if *optR != 0 {
+		rn = rand.New(rand.NewSource(int64(*optR)))
+	} else {
+		t := time.Now().UnixNano()
+		rn = rand.New(rand.NewSource(t))
+	}
 	qf, err := os.Open(query)
 	if err != nil {
 		log.Fatalf("couldn't open %q\n", query)
@@ -130,6 +766,6 @@ func main() {
 	sc := fasta.NewScanner(qf)
 	for sc.ScanSequence() {
 		q := sc.Sequence()
-		clio.ParseFiles(subject, scan, q, mat)
+		clio.ParseFiles(subject, scan, q, mat, rn)
 	}
 }
@@ -34,6 +34,37 @@ func TestAl(t *testing.T) {
 	tests = append(tests, test)
 	test = exec.Command("./al", "-P", "t", "s3.fasta", "s4.fasta")
 	tests = append(tests, test)
+	test = exec.Command("./al", "-t", "-m", "BLOSUM62", "s1.fasta",
+		"s2.fasta")
+	tests = append(tests, test)
+	test = exec.Command("./al", "-t", "-o", "o1.fasta", "o2.fasta")
+	tests = append(tests, test)
+	test = exec.Command("./al", "-f", "-o", "o1.fasta", "o2.fasta")
+	tests = append(tests, test)
+	test = exec.Command("./al", "-t", "-l", "-n", "3", "dmAdhAdhdup.fasta",
+		"dgAdhAdhdup.fasta")
+	tests = append(tests, test)
+	test = exec.Command("./al", "-t", "-l", "-c", "5", "-r", "3",
+		"dmAdhAdhdup.fasta", "dgAdhAdhdup.fasta")
+	tests = append(tests, test)
+	test = exec.Command("./al", "-t", "-l", "-c", "5", "-r", "3", "-z",
+		"dmAdhAdhdup.fasta", "dgAdhAdhdup.fasta")
+	tests = append(tests, test)
+	test = exec.Command("./al", "-H", "-m", "BLOSUM62", "s1.fasta",
+		"s2.fasta")
+	tests = append(tests, test)
+	test = exec.Command("./al", "-H", "dmAdhAdhdup.fasta",
+		"dgAdhAdhdup.fasta")
+	tests = append(tests, test)
+	test = exec.Command("./al", "-b", "50", "dmAdhAdhdup.fasta",
+		"dgAdhAdhdup.fasta")
+	tests = append(tests, test)
+	test = exec.Command("./al", "-t", "-b", "10", "dmAdhAdhdup.fasta",
+		"dgAdhAdhdup.fasta")
+	tests = append(tests, test)
+	test = exec.Command("./al", "-t", "-l", "-n", "3", "rep.fasta",
+		"rep.fasta")
+	tests = append(tests, test)
 	for i, test := range tests {
 		get, err := test.Output()
 		if err != nil {
@@ -16,6 +16,10 @@ import (
 	"text/tabwriter"
 )
 
+type taxonSet struct {
+	taxa  map[string]bool
+	label string
+}
 type clade struct {
 	k string
 	n int
@@ -37,17 +41,52 @@ func (c cladeSlice) Less(i, j int) bool {
 }
 func scan(r io.Reader, args ...interface{}) {
 	refTrees := args[0].([]*nwk.Node)
+	con := args[1].(string)
+	th := args[2].(float64)
+	unrooted := args[3].(bool)
 	sc := nwk.NewScanner(r)
 	clades := make(map[string]int)
 	nt := 0
+	var taxa []string
 	for sc.Scan() {
 		root := sc.Tree()
+		if nt == 0 {
+			taxa = leaves(root, taxa)
+			sort.Strings(taxa)
+		}
 		nt++
-		countClades(root, clades)
+		util.CountClades(root, clades, unrooted)
 	}
-	if len(refTrees) > 0 {
+	if con != "" {
+		if nt > 0 {
+			cs := make([]clade, 0)
+			var c clade
+			for k, n := range clades {
+				c.k = k
+				c.n = n
+				cs = append(cs, c)
+			}
+			sort.Sort(cladeSlice(cs))
+			var picked []taxonSet
+			for i := len(cs) - 1; i >= 0; i-- {
+				s := newTaxonSet(cs[i], nt)
+				f := float64(cs[i].n) / float64(nt)
+				if (con == "strict" && cs[i].n == nt) ||
+					(con == "majority" && f > th) ||
+					(con == "extended" && compatible(s, picked)) {
+					picked = append(picked, s)
+				}
+			}
+			sort.SliceStable(picked, func(i, j int) bool {
+				return len(picked[i].taxa) > len(picked[j].taxa)
+			})
+			root := nwk.NewNode()
+			buildTree(root, taxa, picked)
+			fmt.Println(root)
+		}
+	} else if len(refTrees) > 0 {
 		for _, root := range refTrees {
-			annotateTree(root, clades, nt)
+			util.AnnotateClades(root, clades, nt, unrooted)
 			fmt.Println(root)
 		}
 	} else {
@@ -78,29 +117,96 @@ func scan(r io.Reader, args ...interface{}) {
 		w.Flush()
 	}
 }
-func countClades(v *nwk.Node, c map[string]int) {
+func leaves(v *nwk.Node, l []string) []string {
 	if v == nil {
-		return
+		return l
 	}
-	if v.Parent != nil && v.Child != nil {
-		k := v.Key("$")
-		c[k]++
+	if v.Child == nil {
+		l = append(l, v.Label)
 	}
-	countClades(v.Child, c)
-	countClades(v.Sib, c)
+	l = leaves(v.Child, l)
+	l = leaves(v.Sib, l)
+	return l
 }
-func annotateTree(v *nwk.Node, clades map[string]int, nc int) {
-	if v == nil {
-		return
+func newTaxonSet(c clade, nt int) taxonSet {
+	var s taxonSet
+	s.taxa = make(map[string]bool)
+	for _, t := range strings.Split(c.k, "$") {
+		s.taxa[t] = true
+	}
+	p := math.Round(float64(c.n) / float64(nt) * 100.0)
+	s.label = strconv.Itoa(int(p))
+	return s
+}
+func compatible(s taxonSet, sets []taxonSet) bool {
+	for _, t := range sets {
+		if !disjoint(s, t) && !contains(s, t) && !contains(t, s) {
+			return false
+		}
 	}
-	if v.Parent != nil && v.Child != nil {
-		p := float64(clades[v.Key("$")]) /
-			float64(nc) * 100.0
-		p = math.Round(p)
-		v.Label = strconv.Itoa(int(p))
+	return true
+}
+func disjoint(s, t taxonSet) bool {
+	for x, _ := range s.taxa {
+		if t.taxa[x] {
+			return false
+		}
+	}
+	return true
+}
+func contains(s, t taxonSet) bool {
+	for x, _ := range t.taxa {
+		if !s.taxa[x] {
+			return false
+		}
+	}
+	return true
+}
+func buildTree(v *nwk.Node, taxa []string, clades []taxonSet) {
+	var max []taxonSet
+	for _, c := range clades {
+		isMax := true
+		for _, m := range max {
+			if contains(m, c) {
+				isMax = false
+				break
+			}
+		}
+		if isMax {
+			max = append(max, c)
+		}
+	}
+	nodes := make([]*nwk.Node, len(max))
+	sub := make([][]string, len(max))
+	for _, t := range taxa {
+		leaf := true
+		for i, m := range max {
+			if m.taxa[t] {
+				if nodes[i] == nil {
+					nodes[i] = nwk.NewNode()
+					nodes[i].Label = m.label
+					v.AddChild(nodes[i])
+				}
+				sub[i] = append(sub[i], t)
+				leaf = false
+				break
+			}
+		}
+		if leaf {
+			w := nwk.NewNode()
+			w.Label = t
+			v.AddChild(w)
+		}
+	}
+	for i, m := range max {
+		var inner []taxonSet
+		for _, c := range clades {
+			if len(c.taxa) < len(m.taxa) && contains(m, c) {
+				inner = append(inner, c)
+			}
+		}
+		buildTree(nodes[i], sub[i], inner)
 	}
-	annotateTree(v.Child, clades, nc)
-	annotateTree(v.Sib, clades, nc)
 }
 func main() {
 	util.PrepLog("clac")
@@ -110,10 +216,40 @@ func main() {
 	clio.Usage(u, p, e)
 	var optV = flag.Bool("v", false, "version")
 	var optR = flag.String("r", "", "file of reference tree(s)")
+	var optM = flag.Bool("m", false, "majority-rule consensus")
+	var optE = flag.Bool("e", false, "extended majority-rule consensus")
+	var optS = flag.Bool("s", false, "strict consensus")
+	var optT = flag.Float64("t", 0.5, "threshold of majority-rule "+
+		"consensus, 0.5 <= t < 1")
+	var optU = flag.Bool("u", false, "unrooted trees")
 	flag.Parse()
 	if *optV {
 		util.PrintInfo("clac")
 	}
+	con := ""
+	n := 0
+	if *optM {
+		con = "majority"
+		n++
+	}
+	if *optE {
+		con = "extended"
+		n++
+	}
+	if *optS {
+		con = "strict"
+		n++
+	}
+	if n > 1 {
+		log.Fatal("please choose only one type of consensus")
+	}
+	if con != "" && *optR != "" {
+		log.Fatal("please choose either reference " +
+			"trees or consensus")
+	}
+	if *optT < 0.5 || *optT >= 1 {
+		log.Fatalf("threshold %g should be in [0.5, 1)", *optT)
+	}
 	var refTrees []*nwk.Node
 	if *optR != "" {
 		tf, err := os.Open(*optR)
@@ -127,5 +263,5 @@ func main() {
 		}
 	}
 	files := flag.Args()
-	clio.ParseFiles(files, scan, refTrees)
+	clio.ParseFiles(files, scan, refTrees, con, *optT, *optU)
 }
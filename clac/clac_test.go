@@ -14,6 +14,16 @@ func TestClac(t *testing.T) {
 	tests = append(tests, test)
 	test = exec.Command("./clac", "-r", "ref.nwk", "rest.nwk")
 	tests = append(tests, test)
+	test = exec.Command("./clac", "-m", "trees.nwk")
+	tests = append(tests, test)
+	test = exec.Command("./clac", "-m", "-t", "0.7", "trees.nwk")
+	tests = append(tests, test)
+	test = exec.Command("./clac", "-e", "trees.nwk")
+	tests = append(tests, test)
+	test = exec.Command("./clac", "-s", "trees.nwk")
+	tests = append(tests, test)
+	test = exec.Command("./clac", "-m", "-u", "trees.nwk")
+	tests = append(tests, test)
 	for i, test := range tests {
 		get, err := test.Output()
 		if err != nil {
@@ -8,6 +8,7 @@ import (
 	"github.com/evolbioinf/clio"
 	"github.com/evolbioinf/fasta"
 	"io"
+	"log"
 	"math"
 	"math/rand"
 	"os"
@@ -17,17 +18,40 @@ import (
 )
 
 type cell struct {
-	a, b int
-	d    float64
+	a, b, s       int
+	f             [4][4]int
+	sxy, sxx, syy float64
+	d             float64
 }
 
+var models = []string{"jc", "k80", "f81", "tn84",
+	"hky85", "tn93", "logdet"}
+var protModels = []string{"poisson", "kimura", "score"}
+var aminoAcids = "ACDEFGHIKLMNPQRSTVWY"
+
+func isBlosum62(sm *util.ScoreMatrix) bool {
+	aa := "ARNDCQEGHILKMFPSTWYV"
+	sc := []float64{4, 5, 6, 6, 9, 5, 5, 6, 8, 4,
+		4, 5, 5, 6, 7, 4, 5, 11, 7, 4}
+	for i, c := range []byte(aa) {
+		if sm.Score(c, c) != sc[i] {
+			return false
+		}
+	}
+	return true
+}
 func scan(r io.Reader, args ...interface{}) {
 	optB := args[0].(int)
 	optR := args[1].(bool)
 	optU := args[2].(bool)
-	optK := args[3].(bool)
-	ran := args[4].(*rand.Rand)
-	ts := args[5].(util.TransitionTab)
+	optC := args[3].(bool)
+	optP := args[4].(bool)
+	optA := args[5].(bool)
+	model := args[6].(string)
+	alpha := args[7].(float64)
+	sm := args[8].(*util.ScoreMatrix)
+	ran := args[9].(*rand.Rand)
+	ts := args[10].(util.TransitionTab)
 	sc := fasta.NewScanner(r)
 	var sa []*fasta.Sequence
 	for sc.ScanSequence() {
@@ -57,44 +81,130 @@ func scan(r io.Reader, args ...interface{}) {
 			}
 		}
 	}
-	ind := make([]int, n)
+	res := nuc
+	if optA {
+		res = aa
+	}
+	var cols []int
+	for j := 0; j < n; j++ {
+		keep := true
+		for i := 0; optC && i < m; i++ {
+			if res(msa[i][j]) < 0 {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			cols = append(cols, j)
+		}
+	}
+	if len(cols) == 0 {
+		log.Fatal("no columns left after complete deletion")
+	}
+	ind := make([]int, len(cols))
 	dm := make([][]cell, m)
 	for i := 0; i < m; i++ {
 		dm[i] = make([]cell, m)
 	}
 	if optB > 0 {
 		for i := 0; i < optB; i++ {
-			for j := 0; j < n; j++ {
-				ind[j] = ran.Intn(n)
+			for j, _ := range ind {
+				ind[j] = cols[ran.Intn(len(cols))]
 			}
-			distMat(dm, msa, pol, ind, optR, optU, optK, ts)
+			distMat(dm, msa, pol, ind, optR, optU, optP, optA, model,
+				alpha, sm, ts)
 			printDist(dm, sa)
 			for i := 0; i < m-1; i++ {
 				for j := i + 1; j < m; j++ {
 					dm[i][j].a = 0
 					dm[i][j].b = 0
+					dm[i][j].s = 0
+					dm[i][j].sxy = 0
+					dm[i][j].sxx = 0
+					dm[i][j].syy = 0
+					dm[i][j].f = [4][4]int{}
 				}
 			}
 		}
 	} else {
 		for i, _ := range ind {
-			ind[i] = i
+			ind[i] = cols[i]
 		}
-		distMat(dm, msa, pol, ind, optR, optU, optK, ts)
+		distMat(dm, msa, pol, ind, optR, optU, optP, optA, model,
+			alpha, sm, ts)
 		printDist(dm, sa)
 	}
 }
 func distMat(dm [][]cell, msa [][]byte, pol []bool,
-	ind []int, optR, optU, optK bool,
-	ts util.TransitionTab) {
+	ind []int, optR, optU, optP, optA bool, model string,
+	alpha float64, sm *util.ScoreMatrix, ts util.TransitionTab) {
 	m := len(msa)
-	n := len(msa[0])
-	for i := 0; i < n; i++ {
-		if pol[ind[i]] {
+	n := len(ind)
+	full := !optR && !optU && model != "jc" && model != "k80"
+	var g []float64
+	er := 0.0
+	if optA {
+		for i := 0; i < n; i++ {
+			for j := 0; j < m-1; j++ {
+				c1 := msa[j][ind[i]]
+				if aa(c1) < 0 {
+					continue
+				}
+				for k := j + 1; k < m; k++ {
+					c2 := msa[k][ind[i]]
+					if aa(c2) < 0 {
+						continue
+					}
+					dm[j][k].s++
+					if c1 != c2 {
+						dm[j][k].b++
+					}
+					if sm != nil {
+						dm[j][k].sxy += sm.Score(c1, c2)
+						dm[j][k].sxx += sm.Score(c1, c1)
+						dm[j][k].syy += sm.Score(c2, c2)
+					}
+				}
+			}
+		}
+		if sm != nil {
+			f := resFreqs(msa, ind, aa, len(aminoAcids))
+			for i, x := range f {
+				for j, y := range f {
+					er += x * y * sm.Score(aminoAcids[i], aminoAcids[j])
+				}
+			}
+		}
+	} else if full {
+		for i := 0; i < n; i++ {
+			c := ind[i]
+			for j := 0; j < m-1; j++ {
+				x := nuc(msa[j][c])
+				if x < 0 {
+					continue
+				}
+				for k := j + 1; k < m; k++ {
+					y := nuc(msa[k][c])
+					if y >= 0 {
+						dm[j][k].f[x][y]++
+					}
+				}
+			}
+		}
+		g = resFreqs(msa, ind, nuc, 4)
+	} else if optP {
+		for i := 0; i < n; i++ {
 			for j := 0; j < m-1; j++ {
-				c1 := msa[j][i]
+				c1 := msa[j][ind[i]]
+				if nuc(c1) < 0 {
+					continue
+				}
 				for k := j + 1; k < m; k++ {
-					c2 := msa[k][i]
+					c2 := msa[k][ind[i]]
+					if nuc(c2) < 0 {
+						continue
+					}
+					dm[j][k].s++
 					if c1 != c2 {
 						if ts.IsTransition(c1, c2) {
 							dm[j][k].a++
@@ -105,25 +215,320 @@ func distMat(dm [][]cell, msa [][]byte, pol []bool,
 				}
 			}
 		}
+	} else {
+		for i := 0; i < n; i++ {
+			if pol[ind[i]] {
+				for j := 0; j < m-1; j++ {
+					c1 := msa[j][ind[i]]
+					if c1 == '-' {
+						continue
+					}
+					for k := j + 1; k < m; k++ {
+						c2 := msa[k][ind[i]]
+						if c2 != '-' && c1 != c2 {
+							if ts.IsTransition(c1, c2) {
+								dm[j][k].a++
+							} else {
+								dm[j][k].b++
+							}
+						}
+					}
+				}
+			}
+		}
 	}
 	for i := 0; i < m-1; i++ {
 		for j := i + 1; j < m; j++ {
-			a := float64(dm[i][j].a) / float64(n)
-			b := float64(dm[i][j].b) / float64(n)
+			s := float64(n)
+			if optP {
+				s = float64(dm[i][j].s)
+			}
+			a := float64(dm[i][j].a) / s
+			b := float64(dm[i][j].b) / s
+			f := &dm[i][j].f
 			if optR {
 				dm[i][j].d = float64(dm[i][j].a + dm[i][j].b)
 			} else if optU {
 				dm[i][j].d = a + b
-			} else if optK {
-				dm[i][j].d = -math.Log((1-2*a-b)*math.Sqrt(1-2*b)) / 2
+			} else if model == "k80" {
+				if alpha > 0 {
+					dm[i][j].d = lg(1-2*a-b, alpha)/2 +
+						lg(1-2*b, alpha)/4
+				} else {
+					dm[i][j].d = -math.Log((1-2*a-b)*math.Sqrt(1-2*b)) / 2
+				}
+			} else if model == "f81" {
+				dm[i][j].d = f81(f, g, alpha)
+			} else if model == "tn84" {
+				dm[i][j].d = tajimaNei(f, alpha)
+			} else if model == "hky85" {
+				dm[i][j].d = hky85(f, g, alpha)
+			} else if model == "tn93" {
+				dm[i][j].d = tamuraNei(f, g, alpha)
+			} else if model == "logdet" {
+				dm[i][j].d = logDet(f)
+			} else if model == "poisson" {
+				dm[i][j].d = lg(1-b, alpha)
+			} else if model == "kimura" {
+				dm[i][j].d = -math.Log(1 - b - 0.2*b*b)
+			} else if model == "score" {
+				dm[i][j].d = scoreDist(&dm[i][j], er)
 			} else {
 				p := a + b
-				dm[i][j].d = -0.75 * math.Log(1-4./3.*p)
+				dm[i][j].d = 0.75 * lg(1-4./3.*p, alpha)
+			}
+			d := dm[i][j].d
+			if math.IsNaN(d) || math.IsInf(d, 0) || d < 0 {
+				dm[i][j].d = math.Inf(1)
 			}
 			dm[j][i].d = dm[i][j].d
 		}
 	}
 }
+func nuc(c byte) int {
+	switch c {
+	case 'A':
+		return 0
+	case 'C':
+		return 1
+	case 'G':
+		return 2
+	case 'T':
+		return 3
+	}
+	return -1
+}
+func aa(c byte) int {
+	return strings.IndexByte(aminoAcids, c)
+}
+func resFreqs(msa [][]byte, ind []int, res func(byte) int,
+	k int) []float64 {
+	g := make([]float64, k)
+	s := 0.0
+	for _, row := range msa {
+		for _, c := range ind {
+			x := res(row[c])
+			if x >= 0 {
+				g[x]++
+				s++
+			}
+		}
+	}
+	for i, _ := range g {
+		g[i] /= s
+	}
+	return g
+}
+func scoreDist(c *cell, er float64) float64 {
+	sr := float64(c.s) * er
+	sn := (c.sxy - sr) / ((c.sxx+c.syy)/2 - sr)
+	if sn > 1 {
+		return 0
+	}
+	return -1.337 * math.Log(sn)
+}
+func lg(x, a float64) float64 {
+	if a > 0 {
+		return a * (math.Pow(x, -1/a) - 1)
+	}
+	return -math.Log(x)
+}
+func fracs(f *[4][4]int) ([4][4]float64, float64) {
+	var x [4][4]float64
+	s := 0
+	d := 0
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			s += f[i][j]
+			if i != j {
+				d += f[i][j]
+			}
+		}
+	}
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			x[i][j] = float64(f[i][j]) / float64(s)
+		}
+	}
+	p := float64(d) / float64(s)
+	return x, p
+}
+func f81(f *[4][4]int, g []float64, alpha float64) float64 {
+	_, p := fracs(f)
+	b := 1.0
+	for _, x := range g {
+		b -= x * x
+	}
+	return b * lg(1-p/b, alpha)
+}
+func tajimaNei(f *[4][4]int, alpha float64) float64 {
+	x, p := fracs(f)
+	if p == 0 {
+		return 0
+	}
+	var g [4]float64
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			g[i] += x[i][j] / 2
+			g[j] += x[i][j] / 2
+		}
+	}
+	h := 0.0
+	for i := 0; i < 3; i++ {
+		for j := i + 1; j < 4; j++ {
+			y := x[i][j] + x[j][i]
+			if y > 0 {
+				h += y * y / (2 * g[i] * g[j])
+			}
+		}
+	}
+	b := 1.0
+	for _, y := range g {
+		b -= y * y
+	}
+	b = (b + p*p/h) / 2
+	return b * lg(1-p/b, alpha)
+}
+func tamuraNei(f *[4][4]int, g []float64, alpha float64) float64 {
+	x, p := fracs(f)
+	if p == 0 {
+		return 0
+	}
+	a1 := x[0][2] + x[2][0]
+	a2 := x[1][3] + x[3][1]
+	b := p - a1 - a2
+	ga, gc, gg, gt := g[0], g[1], g[2], g[3]
+	gr := ga + gg
+	gy := gc + gt
+	d := 2 * ga * gg / gr *
+		lg(1-gr/(2*ga*gg)*a1-b/(2*gr), alpha)
+	d += 2 * gc * gt / gy *
+		lg(1-gy/(2*gc*gt)*a2-b/(2*gy), alpha)
+	d += 2 * (gr*gy - ga*gg*gy/gr - gc*gt*gr/gy) *
+		lg(1-b/(2*gr*gy), alpha)
+	return d
+}
+func hky85(f *[4][4]int, g []float64, alpha float64) float64 {
+	_, p := fracs(f)
+	if p == 0 {
+		return 0
+	}
+	ex := func(x float64) float64 {
+		if alpha > 0 {
+			return math.Pow(1+x/alpha, -alpha)
+		}
+		return math.Exp(-x)
+	}
+	var cl [4]float64
+	cl[0] = g[0] + g[2]
+	cl[2] = cl[0]
+	cl[1] = g[1] + g[3]
+	cl[3] = cl[1]
+	ll := func(t, k float64) float64 {
+		mu := 1 / (2 * (cl[0]*cl[1] + k*(g[0]*g[2]+g[1]*g[3])))
+		e1 := ex(mu * t)
+		l := 0.0
+		for i := 0; i < 4; i++ {
+			for j := 0; j < 4; j++ {
+				if f[i][j] == 0 {
+					continue
+				}
+				e2 := ex(mu * t * (1 + cl[j]*(k-1)))
+				var q float64
+				if i == j {
+					q = g[j] + g[j]*(1/cl[j]-1)*e1 +
+						(cl[j]-g[j])/cl[j]*e2
+				} else if (i+j)%2 == 0 {
+					q = g[j] + g[j]*(1/cl[j]-1)*e1 -
+						g[j]/cl[j]*e2
+				} else {
+					q = g[j] * (1 - e1)
+				}
+				l += float64(f[i][j]) * math.Log(g[i]*q)
+			}
+		}
+		return l
+	}
+	tmax := func(k float64) float64 {
+		return maximize(func(t float64) float64 {
+			return ll(t, k)
+		}, 0, 10)
+	}
+	lk := maximize(func(lk float64) float64 {
+		k := math.Exp(lk)
+		return ll(tmax(k), k)
+	}, math.Log(1e-3), math.Log(1e3))
+	t := tmax(math.Exp(lk))
+	if t > 10-1e-6 {
+		return math.Inf(1)
+	}
+	return t
+}
+func maximize(f func(float64) float64, a, b float64) float64 {
+	r := (math.Sqrt(5) - 1) / 2
+	x1 := b - r*(b-a)
+	x2 := a + r*(b-a)
+	f1 := f(x1)
+	f2 := f(x2)
+	for i := 0; i < 100; i++ {
+		if f1 < f2 {
+			a = x1
+			x1, f1 = x2, f2
+			x2 = a + r*(b-a)
+			f2 = f(x2)
+		} else {
+			b = x2
+			x2, f2 = x1, f1
+			x1 = b - r*(b-a)
+			f1 = f(x1)
+		}
+	}
+	return (a + b) / 2
+}
+func logDet(f *[4][4]int) float64 {
+	x, p := fracs(f)
+	if p == 0 {
+		return 0
+	}
+	var gx, gy [4]float64
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			gx[i] += x[i][j]
+			gy[j] += x[i][j]
+		}
+	}
+	lp := 0.0
+	for i := 0; i < 4; i++ {
+		lp += math.Log(gx[i]) + math.Log(gy[i])
+	}
+	return -(math.Log(det(x)) - lp/2) / 4
+}
+func det(x [4][4]float64) float64 {
+	d := 1.0
+	for i := 0; i < 4; i++ {
+		p := i
+		for j := i + 1; j < 4; j++ {
+			if math.Abs(x[j][i]) > math.Abs(x[p][i]) {
+				p = j
+			}
+		}
+		if x[p][i] == 0 {
+			return 0
+		}
+		if p != i {
+			x[p], x[i] = x[i], x[p]
+			d = -d
+		}
+		d *= x[i][i]
+		for j := i + 1; j < 4; j++ {
+			r := x[j][i] / x[i][i]
+			for k := i; k < 4; k++ {
+				x[j][k] -= r * x[i][k]
+			}
+		}
+	}
+	return d
+}
 func printDist(dm [][]cell, sa []*fasta.Sequence) {
 	n := len(dm)
 	fmt.Printf("%d\n", n)
@@ -135,6 +540,15 @@ func printDist(dm [][]cell, sa []*fasta.Sequence) {
 		name := strings.Fields(sa[i].Header())[0]
 		fmt.Fprintf(w, "%s\t", name)
 		for j := 0; j < n; j++ {
+			if math.IsInf(dm[i][j].d, 1) {
+				fmt.Fprintf(w, "Inf\t")
+				if i < j {
+					fmt.Fprintf(os.Stderr, "saturated distance between "+
+						"%s and %s\n", name,
+						strings.Fields(sa[j].Header())[0])
+				}
+				continue
+			}
 			if math.Signbit(dm[i][j].d) {
 				fmt.Fprintf(w, "%.6g\t", 0.0)
 			} else {
@@ -156,13 +570,90 @@ func main() {
 	var optR = flag.Bool("r", false, "raw mismatches")
 	var optU = flag.Bool("u", false, "uncorrected mismatches")
 	var optK = flag.Bool("k", false, "Kimura distances (default: Jukes-Cantor)")
+	var optM = flag.String("m", "jc", "model: jc|k80|f81|tn84|hky85|tn93|logdet; "+
+		"protein: poisson|kimura|score")
+	var optA = flag.Bool("a", false, "amino acid sequences "+
+		"(default: nucleotides)")
+	var optMM = flag.String("M", "", "BLOSUM62 matrix for protein "+
+		"score distances")
+	var optG = flag.Float64("g", 0, "shape parameter of gamma distribution, "+
+		"not for logdet|kimura|score (default: equal rates)")
 	var optB = flag.Int("b", 0, "number of bootstrap replicates")
+	var optC = flag.Bool("c", false, "complete deletion of gapped "+
+		"and ambiguous columns")
+	var optP = flag.Bool("p", false, "pairwise deletion of gapped "+
+		"and ambiguous columns (always for f81, tn84, hky85, tn93, "+
+		"and logdet)")
 	var optS = flag.Int("s", 0, "seed for random number generator "+
 		"(default: internal)")
 	flag.Parse()
 	if *optV {
 		util.PrintInfo("dnaDist")
 	}
+	mset := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "m" {
+			mset = true
+		}
+	})
+	if *optK && mset {
+		log.Fatal("please use either -k or -m")
+	}
+	model := *optM
+	ms := models
+	if *optA {
+		ms = protModels
+		if model == "jc" {
+			model = "poisson"
+		}
+		if *optK {
+			model = "kimura"
+		}
+	} else if *optK {
+		model = "k80"
+	}
+	known := false
+	for _, m := range ms {
+		if m == model {
+			known = true
+			break
+		}
+	}
+	if !known {
+		log.Fatalf("unknown model %q; please use one of %s",
+			model, strings.Join(ms, ", "))
+	}
+	if *optG < 0 {
+		log.Fatalf("gamma shape parameter %g should be positive",
+			*optG)
+	}
+	if *optG > 0 && (model == "logdet" || model == "kimura" ||
+		model == "score") {
+		log.Fatalf("model %q doesn't support gamma rates (-g)",
+			model)
+	}
+	if *optC && *optP {
+		log.Fatal("please choose either complete (-c) " +
+			"or pairwise (-p) deletion")
+	}
+	var sm *util.ScoreMatrix
+	if model == "score" {
+		if *optMM == "" {
+			log.Fatal("please supply a score matrix via -M")
+		}
+		f, err := os.Open(*optMM)
+		if err != nil {
+			log.Fatalf("couldn't open score matrix %q\n",
+				*optMM)
+		}
+		sm = util.ReadScoreMatrix(f)
+		f.Close()
+		if !isBlosum62(sm) {
+			log.Fatalf("score distances are calibrated for "+
+				"BLOSUM62 only, but %q is a different matrix",
+				*optMM)
+		}
+	}
 	if *optB < 0 {
 		fmt.Fprintf(os.Stderr, "resetting %d bootstrap "+
 			"replicates to zero", *optB)
@@ -179,5 +670,6 @@ func main() {
 	}
 	files := flag.Args()
 	ts := util.NewTransitionTab()
-	clio.ParseFiles(files, scan, *optB, *optR, *optU, *optK, ran, ts)
+	clio.ParseFiles(files, scan, *optB, *optR, *optU, *optC, *optP,
+		*optA, model, *optG, sm, ran, ts)
 }
@@ -20,6 +20,40 @@ func TestDnaDist(t *testing.T) {
 	tests = append(tests, c)
 	c = exec.Command("./dnaDist", "-b", "5", "-s", "3", "pr.fa")
 	tests = append(tests, c)
+	models := []string{"f81", "tn84", "hky85", "tn93", "logdet"}
+	for _, m := range models {
+		c = exec.Command("./dnaDist", "-m", m, "pr.fa")
+		tests = append(tests, c)
+	}
+	c = exec.Command("./dnaDist", "-k", "-g", "0.5", "pr.fa")
+	tests = append(tests, c)
+	c = exec.Command("./dnaDist", "-m", "tn93", "-g", "0.5", "pr.fa")
+	tests = append(tests, c)
+	c = exec.Command("./dnaDist", "gap.fa")
+	tests = append(tests, c)
+	c = exec.Command("./dnaDist", "-c", "gap.fa")
+	tests = append(tests, c)
+	c = exec.Command("./dnaDist", "-p", "gap.fa")
+	tests = append(tests, c)
+	c = exec.Command("./dnaDist", "-a", "prot.fa")
+	tests = append(tests, c)
+	c = exec.Command("./dnaDist", "-a", "-k", "prot.fa")
+	tests = append(tests, c)
+	c = exec.Command("./dnaDist", "-a", "-m", "score",
+		"-M", "BLOSUM62", "prot.fa")
+	tests = append(tests, c)
+	models = []string{"jc", "k80", "f81", "tn84", "hky85",
+		"tn93", "logdet"}
+	for _, m := range models {
+		c = exec.Command("./dnaDist", "-m", m, "ident.fa")
+		tests = append(tests, c)
+	}
+	models = []string{"poisson", "kimura", "score"}
+	for _, m := range models {
+		c = exec.Command("./dnaDist", "-a", "-m", m,
+			"-M", "BLOSUM62", "identProt.fa")
+		tests = append(tests, c)
+	}
 	results := make([]string, len(tests))
 	for i, _ := range tests {
 		results[i] = "r" + strconv.Itoa(i+1) + ".txt"
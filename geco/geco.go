@@ -90,12 +90,9 @@ func newGeneticCode() *geneticCode {
 	for i, a := range aa {
 		ai[byte(a)] = i
 	}
-	aaTab := "FFLLSSSSYY**CC*W" +
-		"LLLLPPPPHHQQRRRR" +
-		"IIIMTTTTNNKKSSRR" +
-		"VVVVAAAADDEEGGGG"
-	for i, codon := range gc.codons {
-		gc.codon2int[codon] = ai[aaTab[i]]
+	sc := util.NewGeneticCode(1)
+	for _, codon := range gc.codons {
+		gc.codon2int[codon] = ai[sc.Translate([]byte(codon))]
 	}
 	for _, a := range aa {
 		gc.int2int = append(gc.int2int, ai[byte(a)])
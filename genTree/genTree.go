@@ -1,17 +1,55 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"github.com/evolbioinf/biobox/util"
 	"github.com/evolbioinf/clio"
+	"github.com/evolbioinf/fasta"
 	"github.com/evolbioinf/nwk"
+	"log"
 	"math"
 	"math/rand"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
+type model struct {
+	demes      []int
+	m, g       float64
+	bt, bd, bf float64
+	rho        float64
+	l          int
+}
+type arg struct {
+	times []float64
+	edges []edge
+	n     int
+}
+type edge struct {
+	l, r, p, c int
+}
+type lineage struct {
+	deme int
+	segs []segment
+}
+type segment struct {
+	l, r, node, k int
+}
+type mutModel struct {
+	theta float64
+	l     int
+	pi    [4]float64
+	q     [4][4]float64
+}
+type mutation struct {
+	pos      float64
+	carriers []int
+}
+
 func setBranchLen(v *nwk.Node) {
 	if v == nil {
 		return
@@ -64,6 +102,391 @@ func labelInternalNodes(v *nwk.Node, nc int) int {
 	nc = labelInternalNodes(v.Sib, nc)
 	return nc
 }
+func simulate(mo *model, ran *rand.Rand) *arg {
+	ag := new(arg)
+	var lins []*lineage
+	for i, d := range mo.demes {
+		for j := 0; j < d; j++ {
+			s := segment{l: 0, r: mo.l, node: ag.n, k: 1}
+			lin := &lineage{deme: i, segs: []segment{s}}
+			lins = append(lins, lin)
+			ag.times = append(ag.times, 0)
+			ag.n++
+		}
+	}
+	t := 0.0
+	for len(lins) > 0 {
+		counts := make([]int, len(mo.demes))
+		links := make([]int, len(lins))
+		tl := 0
+		for i, lin := range lins {
+			counts[lin.deme]++
+			links[i] = lin.segs[len(lin.segs)-1].r - lin.segs[0].l - 1
+			tl += links[i]
+		}
+		pairs := 0.0
+		for _, c := range counts {
+			pairs += float64(c * (c - 1) / 2)
+		}
+		mig := 0.0
+		if len(mo.demes) > 1 {
+			mig = float64(len(lins)) * mo.m / 2.0
+		}
+		rec := mo.rho / 2.0 * float64(tl) / float64(mo.l-1)
+		tc := math.Inf(1)
+		if pairs > 0 {
+			tc = coalTime(t, ran.ExpFloat64()/pairs, mo)
+		}
+		to := math.Inf(1)
+		if mig+rec > 0 {
+			to = t + ran.ExpFloat64()/(mig+rec)
+		}
+		if math.IsInf(tc, 1) && math.IsInf(to, 1) {
+			log.Fatal("lineages never coalesce")
+		}
+		if tc <= to {
+			t = tc
+			u := ran.Float64() * pairs
+			d := 0
+			for u >= float64(counts[d]*(counts[d]-1)/2) {
+				u -= float64(counts[d] * (counts[d] - 1) / 2)
+				d++
+			}
+			var idx []int
+			for i, lin := range lins {
+				if lin.deme == d {
+					idx = append(idx, i)
+				}
+			}
+			r := ran.Intn(len(idx))
+			i := idx[r]
+			idx[r] = idx[len(idx)-1]
+			j := idx[ran.Intn(len(idx)-1)]
+			lins[i].segs = ag.coalesce(lins[i].segs, lins[j].segs, t)
+			lins[j] = lins[len(lins)-1]
+			lins = lins[:len(lins)-1]
+			if i == len(lins) {
+				i = j
+			}
+			if len(lins[i].segs) == 0 {
+				lins[i] = lins[len(lins)-1]
+				lins = lins[:len(lins)-1]
+			}
+		} else {
+			t = to
+			if ran.Float64()*(mig+rec) < mig {
+				lin := lins[ran.Intn(len(lins))]
+				d := ran.Intn(len(mo.demes) - 1)
+				if d >= lin.deme {
+					d++
+				}
+				lin.deme = d
+			} else {
+				u := ran.Intn(tl)
+				i := 0
+				for u >= links[i] {
+					u -= links[i]
+					i++
+				}
+				lin := lins[i]
+				b := lin.segs[0].l + 1 + u
+				var left, right []segment
+				for _, s := range lin.segs {
+					if s.r <= b {
+						left = append(left, s)
+					} else if s.l >= b {
+						right = append(right, s)
+					} else {
+						sl, sr := s, s
+						sl.r = b
+						sr.l = b
+						left = append(left, sl)
+						right = append(right, sr)
+					}
+				}
+				lin.segs = left
+				lins = append(lins, &lineage{deme: lin.deme, segs: right})
+			}
+		}
+	}
+	return ag
+}
+func coalTime(t, h float64, mo *model) float64 {
+	bounds := []float64{mo.bt, mo.bt + mo.bd, math.Inf(1)}
+	factors := []float64{1, mo.bf, 1}
+	for i, b := range bounds {
+		if t >= b {
+			continue
+		}
+		f := factors[i]
+		full := (b - t) / f
+		if mo.g != 0 {
+			full = (math.Exp(mo.g*b) - math.Exp(mo.g*t)) /
+				(mo.g * f)
+		}
+		if h < full {
+			if mo.g == 0 {
+				return t + h*f
+			}
+			return math.Log(math.Exp(mo.g*t)+mo.g*f*h) / mo.g
+		}
+		h -= full
+		t = b
+	}
+	return math.Inf(1)
+}
+func (a *arg) coalesce(x, y []segment, t float64) []segment {
+	var pos []int
+	for _, s := range x {
+		pos = append(pos, s.l, s.r)
+	}
+	for _, s := range y {
+		pos = append(pos, s.l, s.r)
+	}
+	sort.Ints(pos)
+	var res []segment
+	v := -1
+	for i := 1; i < len(pos); i++ {
+		l, r := pos[i-1], pos[i]
+		if l == r {
+			continue
+		}
+		sx, okx := findSeg(x, l)
+		sy, oky := findSeg(y, l)
+		var s segment
+		if okx && oky {
+			if v < 0 {
+				v = len(a.times)
+				a.times = append(a.times, t)
+			}
+			a.addEdge(l, r, v, sx.node)
+			a.addEdge(l, r, v, sy.node)
+			s = segment{l: l, r: r, node: v, k: sx.k + sy.k}
+			if s.k == a.n {
+				continue
+			}
+		} else if okx {
+			s = segment{l: l, r: r, node: sx.node, k: sx.k}
+		} else if oky {
+			s = segment{l: l, r: r, node: sy.node, k: sy.k}
+		} else {
+			continue
+		}
+		m := len(res)
+		if m > 0 && res[m-1].r == l && res[m-1].node == s.node &&
+			res[m-1].k == s.k {
+			res[m-1].r = r
+		} else {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+func (a *arg) addEdge(l, r, p, c int) {
+	for i := len(a.edges) - 1; i >= 0 && a.edges[i].p == p; i-- {
+		e := &a.edges[i]
+		if e.c == c && e.r == l {
+			e.r = r
+			return
+		}
+	}
+	a.edges = append(a.edges, edge{l: l, r: r, p: p, c: c})
+}
+func (a *arg) trees(l int) ([]*nwk.Node, []int) {
+	pos := []int{0, l}
+	for _, e := range a.edges {
+		pos = append(pos, e.l, e.r)
+	}
+	sort.Ints(pos)
+	var roots []*nwk.Node
+	var lengths []int
+	for i := 1; i < len(pos); i++ {
+		if pos[i-1] == pos[i] {
+			continue
+		}
+		children := make(map[int][]int)
+		isChild := make(map[int]bool)
+		for _, e := range a.edges {
+			if e.l <= pos[i-1] && pos[i] <= e.r {
+				children[e.p] = append(children[e.p], e.c)
+				isChild[e.c] = true
+			}
+		}
+		root := 0
+		for p, _ := range children {
+			if !isChild[p] {
+				root = p
+			}
+		}
+		roots = append(roots, a.newick(root, children))
+		lengths = append(lengths, pos[i]-pos[i-1])
+	}
+	return roots, lengths
+}
+func (a *arg) newick(v int, children map[int][]int) *nwk.Node {
+	x := nwk.NewNode()
+	if v < a.n {
+		x.Label = "T" + strconv.Itoa(v+1)
+	}
+	for _, c := range children[v] {
+		y := a.newick(c, children)
+		y.Length = a.times[v] - a.times[c]
+		y.HasLength = true
+		x.AddChild(y)
+	}
+	return x
+}
+func findSeg(segs []segment, p int) (segment, bool) {
+	for _, s := range segs {
+		if s.l <= p && p < s.r {
+			return s, true
+		}
+	}
+	return segment{}, false
+}
+func rateMatrix(pi [4]float64, kappa float64) [4][4]float64 {
+	var q [4][4]float64
+	s := 0.0
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			if i == j {
+				continue
+			}
+			q[i][j] = pi[j]
+			if (i+j)%2 == 0 {
+				q[i][j] *= kappa
+			}
+			q[i][i] -= q[i][j]
+		}
+		s -= pi[i] * q[i][i]
+	}
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			q[i][j] /= s
+		}
+	}
+	return q
+}
+func printSegSites(roots []*nwk.Node, lengths []int, n int,
+	mm *mutModel, ran *rand.Rand) {
+	var muts []mutation
+	start := 0
+	for i, root := range roots {
+		th := mm.theta * float64(lengths[i]) / float64(mm.l)
+		muts, _ = placeMut(root, th, start, lengths[i], mm.l,
+			muts, ran)
+		start += lengths[i]
+	}
+	sort.Slice(muts, func(i, j int) bool {
+		return muts[i].pos < muts[j].pos
+	})
+	fmt.Println("//")
+	fmt.Printf("segsites: %d\n", len(muts))
+	fmt.Printf("positions:")
+	for _, m := range muts {
+		fmt.Printf(" %.4f", m.pos)
+	}
+	fmt.Printf("\n")
+	rows := make([][]byte, n)
+	for i := 0; i < n; i++ {
+		rows[i] = bytes.Repeat([]byte("0"), len(muts))
+	}
+	for j, m := range muts {
+		for _, i := range m.carriers {
+			rows[i][j] = '1'
+		}
+	}
+	for _, row := range rows {
+		fmt.Println(string(row))
+	}
+}
+func placeMut(v *nwk.Node, th float64, start, l, sl int,
+	muts []mutation, ran *rand.Rand) ([]mutation, []int) {
+	var below []int
+	if v.Child == nil {
+		below = append(below, sampleIndex(v.Label))
+	}
+	for c := v.Child; c != nil; c = c.Sib {
+		var b []int
+		muts, b = placeMut(c, th, start, l, sl, muts, ran)
+		below = append(below, b...)
+	}
+	if v.Parent != nil && th > 0 {
+		t := ran.ExpFloat64() / (th / 2.0)
+		for t < v.Length {
+			p := (float64(start) + ran.Float64()*
+				float64(l)) / float64(sl)
+			muts = append(muts, mutation{pos: p, carriers: below})
+			t += ran.ExpFloat64() / (th / 2.0)
+		}
+	}
+	return muts, below
+}
+func sampleIndex(label string) int {
+	i, err := strconv.Atoi(strings.TrimPrefix(label, "T"))
+	if err != nil {
+		log.Fatalf("couldn't parse leaf label %q", label)
+	}
+	return i - 1
+}
+func printAlignment(roots []*nwk.Node, lengths []int, n int,
+	mm *mutModel, ran *rand.Rand) {
+	seqs := make([][]byte, n)
+	rate := mm.theta / 2.0 / float64(mm.l)
+	for i, root := range roots {
+		seq := make([]byte, lengths[i])
+		for j := range seq {
+			u := ran.Float64()
+			k := 0
+			for k < 3 && u >= mm.pi[k] {
+				u -= mm.pi[k]
+				k++
+			}
+			seq[j] = byte(k)
+		}
+		evolve(root, seq, rate, mm, seqs, ran)
+	}
+	for i, seq := range seqs {
+		h := "T" + strconv.Itoa(i+1)
+		fmt.Println(fasta.NewSequence(h, seq))
+	}
+}
+func evolve(v *nwk.Node, seq []byte, rate float64, mm *mutModel,
+	seqs [][]byte, ran *rand.Rand) {
+	if v.Child == nil {
+		i := sampleIndex(v.Label)
+		for _, c := range seq {
+			seqs[i] = append(seqs[i], "ACGT"[c])
+		}
+		return
+	}
+	for c := v.Child; c != nil; c = c.Sib {
+		s := make([]byte, len(seq))
+		copy(s, seq)
+		for j := range s {
+			x := s[j]
+			t := ran.ExpFloat64() / (-mm.q[x][x] * rate)
+			for t < c.Length {
+				u := ran.Float64() * -mm.q[x][x]
+				y := x
+				for k := byte(0); k < 4; k++ {
+					if k == x {
+						continue
+					}
+					y = k
+					if u < mm.q[x][k] {
+						break
+					}
+					u -= mm.q[x][k]
+				}
+				x = y
+				t += ran.ExpFloat64() / (-mm.q[x][x] * rate)
+			}
+			s[j] = x
+		}
+		evolve(c, s, rate, mm, seqs, ran)
+	}
+}
 func main() {
 	util.PrepLog("genTree")
 	u := "genTree [-h] [option]..."
@@ -78,6 +501,21 @@ func main() {
 	var optL = flag.Bool("l", false, "label internal branches")
 	var optS = flag.Int("s", 0, "seed for random number generator")
 	var optV = flag.Bool("v", false, "version")
+	var optG = flag.Float64("g", 0, "growth rate")
+	var optB = flag.String("b", "", "bottleneck as start,duration,factor; "+
+		"e.g. 0.1,0.05,0.01")
+	var optD = flag.String("d", "", "sample sizes of demes, e.g. 5,5; "+
+		"overrides -n")
+	var optM = flag.Float64("m", 0, "migration rate, M=2Nm")
+	var optR = flag.Float64("r", 0, "recombination rate, rho=2Nr")
+	var optLL = flag.Int("L", 10000, "number of sites")
+	var optO = flag.String("o", "nwk", "output format: nwk|ms|fasta")
+	var optMM = flag.String("M", "jc", "substitution model for "+
+		"fasta: jc|k80|f81|hky")
+	var optK = flag.Float64("k", 2, "transition/transversion ratio "+
+		"for k80 and hky")
+	var optF = flag.String("f", "0.25,0.25,0.25,0.25",
+		"frequencies of A,C,G,T for f81 and hky")
 	flag.Parse()
 	if *optV {
 		util.PrintInfo("genTree")
@@ -87,9 +525,126 @@ func main() {
 		seed = time.Now().UnixNano()
 	}
 	ran := rand.New(rand.NewSource(seed))
+	popModel := *optG != 0 || *optB != "" || *optD != "" || *optR > 0
+	mo := new(model)
+	mo.m = *optM
+	mo.g = *optG
+	mo.bf = 1.0
+	mo.rho = *optR
+	mo.l = *optLL
+	if *optB != "" {
+		fields := strings.Split(*optB, ",")
+		if len(fields) != 3 {
+			log.Fatalf("please give bottleneck as " +
+				"start,duration,factor")
+		}
+		x := make([]float64, 3)
+		var err error
+		for i, field := range fields {
+			x[i], err = strconv.ParseFloat(field, 64)
+			if err != nil {
+				log.Fatalf("couldn't parse %q", field)
+			}
+		}
+		mo.bt, mo.bd, mo.bf = x[0], x[1], x[2]
+	}
+	if *optD != "" {
+		*optN = 0
+		for _, field := range strings.Split(*optD, ",") {
+			d, err := strconv.Atoi(field)
+			if err != nil || d < 0 {
+				log.Fatalf("couldn't parse deme size %q", field)
+			}
+			mo.demes = append(mo.demes, d)
+			*optN += d
+		}
+	} else {
+		mo.demes = append(mo.demes, *optN)
+	}
+	if popModel {
+		if *optN < 2 {
+			log.Fatal("please use a sample size of at least 2")
+		}
+		if mo.l < 2 {
+			log.Fatal("please use at least 2 sites")
+		}
+		if mo.bf <= 0 || mo.bd < 0 || mo.bt < 0 {
+			log.Fatal("please use a bottleneck with " +
+				"non-negative start and duration, " +
+				"and positive factor")
+		}
+		if len(mo.demes) > 1 && mo.m <= 0 {
+			log.Fatal("demes never coalesce without migration")
+		}
+	}
+	if *optO != "nwk" && *optO != "ms" && *optO != "fasta" {
+		log.Fatalf("unknown output format %q", *optO)
+	}
+	mm := new(mutModel)
+	mm.theta = *optT
+	mm.l = mo.l
+	fields := strings.Split(*optF, ",")
+	if len(fields) != 4 {
+		log.Fatal("please give four nucleotide frequencies")
+	}
+	sum := 0.0
+	for i, field := range fields {
+		x, err := strconv.ParseFloat(field, 64)
+		if err != nil || x <= 0 {
+			log.Fatalf("couldn't parse frequency %q", field)
+		}
+		mm.pi[i] = x
+		sum += x
+	}
+	for i := 0; i < 4; i++ {
+		mm.pi[i] /= sum
+	}
+	kappa := *optK
+	switch *optMM {
+	case "jc":
+		mm.pi = [4]float64{0.25, 0.25, 0.25, 0.25}
+		kappa = 1
+	case "k80":
+		mm.pi = [4]float64{0.25, 0.25, 0.25, 0.25}
+	case "f81":
+		kappa = 1
+	case "hky":
+	default:
+		log.Fatalf("unknown substitution model %q", *optMM)
+	}
+	mm.q = rateMatrix(mm.pi, kappa)
 	n := *optN
 	tree := make([]*nwk.Node, 2*n-1)
 	for ii := 0; ii < *optI; ii++ {
+		if popModel {
+			ag := simulate(mo, ran)
+			roots, lengths := ag.trees(mo.l)
+			if *optO == "nwk" {
+				if mo.rho > 0 {
+					fmt.Println("//")
+				}
+				for i, root := range roots {
+					if !*optA {
+						th := *optT * float64(lengths[i]) / float64(mo.l)
+						addMut(root, th, ran)
+					}
+					if *optL {
+						labelInternalNodes(root, 0)
+					}
+					if mo.rho > 0 {
+						fmt.Printf("[%d]", lengths[i])
+					}
+					fmt.Println(root)
+				}
+			} else {
+				if *optO == "ms" {
+					printSegSites(roots, lengths, n, mm, ran)
+				} else {
+					printAlignment(roots, lengths, n, mm, ran)
+				}
+			}
+			continue
+		}
 		for i := 0; i < 2*n-1; i++ {
 			tree[i] = nwk.NewNode()
 		}
@@ -120,6 +675,17 @@ func main() {
 		}
 		root := tree[len(tree)-1]
 		setBranchLen(root)
+		if *optO != "nwk" {
+			labelLeaves(root, 0)
+			roots := []*nwk.Node{root}
+			lengths := []int{mo.l}
+			if *optO == "ms" {
+				printSegSites(roots, lengths, n, mm, ran)
+			} else {
+				printAlignment(roots, lengths, n, mm, ran)
+			}
+			continue
+		}
 		if !*optA {
 			addMut(root, *optT, ran)
 		}
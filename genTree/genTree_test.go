@@ -23,6 +23,29 @@ func TestGenTree(t *testing.T) {
 	test = exec.Command("./genTree", "-s", "13", "-n", "9")
 	tests = append(tests, test)
 	test = exec.Command("./genTree", "-s", "13", "-t", "500")
+	tests = append(tests, test)
+	test = exec.Command("./genTree", "-s", "13", "-g", "2")
+	tests = append(tests, test)
+	test = exec.Command("./genTree", "-s", "13", "-b", "0.1,0.2,0.01")
+	tests = append(tests, test)
+	test = exec.Command("./genTree", "-s", "13", "-d", "4,4", "-m", "0.5")
+	tests = append(tests, test)
+	test = exec.Command("./genTree", "-s", "13", "-n", "5", "-r", "5",
+		"-L", "1000", "-i", "2")
+	tests = append(tests, test)
+	test = exec.Command("./genTree", "-s", "13", "-n", "5", "-t", "5",
+		"-o", "ms")
+	tests = append(tests, test)
+	test = exec.Command("./genTree", "-s", "13", "-n", "5", "-t", "5",
+		"-r", "5", "-o", "ms")
+	tests = append(tests, test)
+	test = exec.Command("./genTree", "-s", "13", "-n", "5", "-t", "5",
+		"-L", "60", "-o", "fasta")
+	tests = append(tests, test)
+	test = exec.Command("./genTree", "-s", "13", "-n", "5", "-t", "5",
+		"-L", "60", "-o", "fasta", "-M", "hky", "-k", "5",
+		"-f", "0.1,0.4,0.4,0.1")
+	tests = append(tests, test)
 	for i, test := range tests {
 		get, err := test.Output()
 		if err != nil {
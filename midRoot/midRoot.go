@@ -7,60 +7,173 @@ import (
 	"github.com/evolbioinf/clio"
 	"github.com/evolbioinf/nwk"
 	"io"
+	"log"
 	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"text/tabwriter"
 )
 
+type rootParams struct {
+	method              string
+	outgroup, date      *regexp.Regexp
+	printPair, printTab bool
+}
+
 func scan(r io.Reader, args ...interface{}) {
-	printPair := args[0].(bool)
+	rp := args[0].(*rootParams)
 	sc := nwk.NewScanner(r)
 	for sc.Scan() {
 		root := sc.Tree()
 		var leaves []*nwk.Node
 		leaves = collectLeaves(root, leaves)
-		n := len(leaves)
-		max := -math.MaxFloat64
-		var mi, mj int
-		for i := 0; i < n-1; i++ {
-			for j := i + 1; j < n; j++ {
-				l1 := leaves[i]
-				l2 := leaves[j]
-				a := l1.LCA(l2)
-				d := l1.UpDistance(a) + l2.UpDistance(a)
-				if max < d {
-					max = d
-					mi = i
-					mj = j
+		var v *nwk.Node
+		var x float64
+		var dates []float64
+		switch rp.method {
+		case "mid":
+			n := len(leaves)
+			max := -math.MaxFloat64
+			var mi, mj int
+			for i := 0; i < n-1; i++ {
+				for j := i + 1; j < n; j++ {
+					l1 := leaves[i]
+					l2 := leaves[j]
+					a := l1.LCA(l2)
+					d := l1.UpDistance(a) + l2.UpDistance(a)
+					if max < d {
+						max = d
+						mi = i
+						mj = j
+					}
+				}
+			}
+			if rp.printPair {
+				fmt.Printf("# d(%s, %s): %.3g\n",
+					leaves[mi].Label, leaves[mj].Label, max)
+			}
+			l1 := leaves[mi]
+			l2 := leaves[mj]
+			a := l1.LCA(l2)
+			v = l1
+			if l1.UpDistance(a) < l2.UpDistance(a) {
+				v = l2
+			}
+			s := v.Length
+			for s < max/2.0 {
+				v = v.Parent
+				s += v.Length
+			}
+			x = v.Length - (s - max/2.0)
+		case "out":
+			var og, ig []*nwk.Node
+			for _, l := range leaves {
+				if rp.outgroup.MatchString(l.Label) {
+					og = append(og, l)
+				} else {
+					ig = append(ig, l)
+				}
+			}
+			if len(og) == 0 || len(ig) == 0 {
+				log.Fatal("the outgroup should contain some, " +
+					"but not all taxa")
+			}
+			v = lca(og)
+			if v.Parent == nil {
+				og = ig
+				v = lca(og)
+			}
+			var below []*nwk.Node
+			below = collectLeaves(v.Child, below)
+			if v.Child == nil {
+				below = append(below, v)
+			}
+			if v.Parent == nil || len(below) != len(og) {
+				log.Fatal("outgroup isn't monophyletic")
+			}
+			x = v.Length / 2.0
+		case "mv", "rtt":
+			if rp.method == "rtt" {
+				dates = make([]float64, len(leaves))
+				for i, l := range leaves {
+					m := rp.date.FindStringSubmatch(l.Label)
+					if len(m) < 2 {
+						log.Fatalf("couldn't find date in %q", l.Label)
+					}
+					d, err := strconv.ParseFloat(m[1], 64)
+					if err != nil {
+						log.Fatalf("couldn't parse date %q", m[1])
+					}
+					dates[i] = d
+				}
+				if dot(residuals(dates, nil), residuals(dates, nil)) == 0 {
+					log.Fatal("all tips have the same date")
+				}
+			}
+			var nodes []*nwk.Node
+			nodes = collectNodes(root, nodes)
+			best := math.Inf(1)
+			for _, w := range nodes {
+				if w.Parent == nil {
+					continue
+				}
+				a := make([]float64, len(leaves))
+				sg := make([]float64, len(leaves))
+				for i, l := range leaves {
+					c := l.LCA(w)
+					a[i] = l.UpDistance(c) + w.UpDistance(c)
+					sg[i] = -1
+					if c == w {
+						sg[i] = 1
+					}
+				}
+				ra := residuals(a, dates)
+				rs := residuals(sg, dates)
+				aa, as, ss := dot(ra, ra), dot(ra, rs), dot(rs, rs)
+				y := w.Length / 2.0
+				if ss > 0 {
+					y = math.Min(math.Max(-as/ss, 0), w.Length)
+				}
+				q := aa + 2.0*y*as + y*y*ss
+				if q < best {
+					best = q
+					v = w
+					x = y
 				}
 			}
 		}
-		if printPair {
-			fmt.Printf("# d(%s, %s): %.3g\n",
-				leaves[mi].Label, leaves[mj].Label, max)
-		}
-		l1 := leaves[mi]
-		l2 := leaves[mj]
-		a := l1.LCA(l2)
-		v := l1
-		if l1.UpDistance(a) < l2.UpDistance(a) {
-			v = l2
+		root = reroot(root, v, x)
+		if rp.method == "rtt" && rp.printPair {
+			y := make([]float64, len(leaves))
+			for i, l := range leaves {
+				y[i] = l.UpDistance(root)
+			}
+			b, c := regress(y, dates)
+			r := residuals(y, dates)
+			m := residuals(y, nil)
+			r2 := 1.0 - dot(r, r)/dot(m, m)
+			fmt.Printf("# rate: %.3g, root date: %.6g, R^2: %.3g\n",
+				b, -c/b, r2)
 		}
-		s := v.Length
-		for s < max/2.0 {
-			v = v.Parent
-			s += v.Length
+		if rp.printTab {
+			w := tabwriter.NewWriter(os.Stdout, 1, 1, 1, ' ', 0)
+			fmt.Fprintf(w, "#Taxon\tDistance")
+			if dates != nil {
+				fmt.Fprintf(w, "\tDate")
+			}
+			fmt.Fprintf(w, "\n")
+			for i, l := range leaves {
+				fmt.Fprintf(w, "%s\t%.3g", l.Label, l.UpDistance(root))
+				if dates != nil {
+					fmt.Fprintf(w, "\t%g", dates[i])
+				}
+				fmt.Fprintf(w, "\n")
+			}
+			w.Flush()
+		} else {
+			fmt.Println(root)
 		}
-		r := nwk.NewNode()
-		p := v.Parent
-		p.AddChild(r)
-		p.RemoveChild(v)
-		r.AddChild(v)
-		x2 := s - max/2.0
-		x1 := v.Length - x2
-		v.Length = x1
-		r.Length = x2
-		parentToChild(r)
-		root = r
-		fmt.Println(root)
 	}
 }
 func collectLeaves(v *nwk.Node, l []*nwk.Node) []*nwk.Node {
@@ -74,6 +187,25 @@ func collectLeaves(v *nwk.Node, l []*nwk.Node) []*nwk.Node {
 	}
 	return l
 }
+func reroot(root, v *nwk.Node, x float64) *nwk.Node {
+	r := nwk.NewNode()
+	p := v.Parent
+	p.AddChild(r)
+	p.RemoveChild(v)
+	r.AddChild(v)
+	r.Length = v.Length - x
+	v.Length = x
+	parentToChild(r)
+	if root != r && root.Child != nil && root.Child.Sib == nil {
+		c := root.Child
+		p := root.Parent
+		root.RemoveChild(c)
+		p.RemoveChild(root)
+		c.Length += root.Length
+		p.AddChild(c)
+	}
+	return r
+}
 func parentToChild(v *nwk.Node) {
 	if v.Parent.Parent != nil {
 		parentToChild(v.Parent)
@@ -84,18 +216,103 @@ func parentToChild(v *nwk.Node) {
 	p.Length = v.Length
 	p.HasLength = true
 }
+func lca(nodes []*nwk.Node) *nwk.Node {
+	a := nodes[0]
+	for _, v := range nodes[1:] {
+		a = a.LCA(v)
+	}
+	return a
+}
+func collectNodes(v *nwk.Node, l []*nwk.Node) []*nwk.Node {
+	if v == nil {
+		return l
+	}
+	l = append(l, v)
+	l = collectNodes(v.Child, l)
+	l = collectNodes(v.Sib, l)
+	return l
+}
+func residuals(y, t []float64) []float64 {
+	r := make([]float64, len(y))
+	b, c := regress(y, t)
+	for i, yi := range y {
+		r[i] = yi - c
+		if t != nil {
+			r[i] -= b * t[i]
+		}
+	}
+	return r
+}
+func regress(y, t []float64) (float64, float64) {
+	n := float64(len(y))
+	my, mt := 0.0, 0.0
+	for i, yi := range y {
+		my += yi
+		if t != nil {
+			mt += t[i]
+		}
+	}
+	my /= n
+	mt /= n
+	if t == nil {
+		return 0, my
+	}
+	sty, stt := 0.0, 0.0
+	for i, yi := range y {
+		sty += (t[i] - mt) * (yi - my)
+		stt += (t[i] - mt) * (t[i] - mt)
+	}
+	b := sty / stt
+	return b, my - b*mt
+}
+func dot(x, y []float64) float64 {
+	s := 0.0
+	for i, xi := range x {
+		s += xi * y[i]
+	}
+	return s
+}
 func main() {
 	util.PrepLog("midRoot")
 	u := "midRoot [-h] [option]... [foo.nwk]..."
-	p := "Add midpoint root to a tree."
+	p := "Add midpoint root to a tree, or root it by outgroup, " +
+		"minimum variance, or root-to-tip regression."
 	e := "midRoot foo.nwk"
 	clio.Usage(u, p, e)
 	var optV = flag.Bool("v", false, "version")
-	var optP = flag.Bool("p", false, "print most distant pair")
+	var optP = flag.Bool("p", false, "print most distant pair, "+
+		"or regression with -m rtt")
+	var optM = flag.String("m", "mid", "rooting method, "+
+		"mid(point)|mv (minimum variance)|rtt (root-to-tip regression)")
+	var optO = flag.String("o", "", "outgroup; regular expression "+
+		"matching complete taxon labels, overrides -m")
+	var optD = flag.String("d", "([0-9.]+)$", "regular expression "+
+		"with group capturing date in taxon label")
+	var optT = flag.Bool("t", false, "print table of "+
+		"root-to-tip distances instead of tree")
 	flag.Parse()
 	if *optV {
 		util.PrintInfo("midRoot")
 	}
+	rp := new(rootParams)
+	rp.method = *optM
+	if rp.method != "mid" && rp.method != "mv" && rp.method != "rtt" {
+		log.Fatalf("unknown rooting method %q", rp.method)
+	}
+	var err error
+	if *optO != "" {
+		rp.method = "out"
+		rp.outgroup, err = regexp.Compile("^(" + *optO + ")$")
+		if err != nil {
+			log.Fatalf("couldn't compile %q", *optO)
+		}
+	}
+	rp.date, err = regexp.Compile(*optD)
+	if err != nil {
+		log.Fatalf("couldn't compile %q", *optD)
+	}
+	rp.printPair = *optP
+	rp.printTab = *optT
 	files := flag.Args()
-	clio.ParseFiles(files, scan, *optP)
+	clio.ParseFiles(files, scan, rp)
 }
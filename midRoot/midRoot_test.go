@@ -8,16 +8,34 @@ import (
 )
 
 func TestMidRoot(t *testing.T) {
-	cmd := exec.Command("./midRoot", "-p", "test.nwk")
-	get, err := cmd.Output()
-	if err != nil {
-		t.Errorf("can't run %q", cmd)
-	}
-	want, err := ioutil.ReadFile("r.txt")
-	if err != nil {
-		t.Errorf("can't optn r.txt")
-	}
-	if !bytes.Equal(get, want) {
-		t.Errorf("get:\n%s\nwant:\n%s\n", get, want)
+	var tests []*exec.Cmd
+	test := exec.Command("./midRoot", "-p", "test.nwk")
+	tests = append(tests, test)
+	test = exec.Command("./midRoot", "-o", "t4", "test.nwk")
+	tests = append(tests, test)
+	test = exec.Command("./midRoot", "-o", "t[35]", "test.nwk")
+	tests = append(tests, test)
+	test = exec.Command("./midRoot", "-m", "mv", "test.nwk")
+	tests = append(tests, test)
+	test = exec.Command("./midRoot", "-t", "test.nwk")
+	tests = append(tests, test)
+	test = exec.Command("./midRoot", "-m", "rtt", "-p", "dated.nwk")
+	tests = append(tests, test)
+	test = exec.Command("./midRoot", "-m", "rtt", "-t", "dated.nwk")
+	tests = append(tests, test)
+	results := []string{"r.txt", "r2.txt", "r3.txt", "r4.txt",
+		"r5.txt", "r6.txt", "r7.txt"}
+	for i, test := range tests {
+		get, err := test.Output()
+		if err != nil {
+			t.Errorf("can't run %q", test)
+		}
+		want, err := ioutil.ReadFile(results[i])
+		if err != nil {
+			t.Errorf("can't open %q", results[i])
+		}
+		if !bytes.Equal(get, want) {
+			t.Errorf("get:\n%s\nwant:\n%s\n", get, want)
+		}
 	}
 }
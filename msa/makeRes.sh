@@ -0,0 +1,3 @@
+./msa test.fasta > r1.txt
+./msa -n test.fasta > r2.txt
+./msa -t test.fasta > r3.txt
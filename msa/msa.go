@@ -0,0 +1,321 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/evolbioinf/biobox/util"
+	"github.com/evolbioinf/clio"
+	"github.com/evolbioinf/dist"
+	"github.com/evolbioinf/fasta"
+	"github.com/evolbioinf/nwk"
+	"github.com/evolbioinf/pal"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type profile struct {
+	rows [][]byte
+	ids  []int
+}
+type count struct {
+	r byte
+	n int
+}
+
+const (
+	stM = iota
+	stX
+	stY
+)
+
+func scan(r io.Reader, args ...interface{}) {
+	mat := args[0].(*pal.ScoreMatrix)
+	gapO := args[1].(float64)
+	gapE := args[2].(float64)
+	useNj := args[3].(bool)
+	printTree := args[4].(bool)
+	ll := args[5].(int)
+	var seqs []*fasta.Sequence
+	sc := fasta.NewScanner(r)
+	for sc.ScanSequence() {
+		seqs = append(seqs, sc.Sequence())
+	}
+	if len(seqs) < 2 {
+		for _, seq := range seqs {
+			seq.SetLineLength(ll)
+			fmt.Println(seq)
+		}
+		return
+	}
+	dm := distances(seqs, mat, gapO, gapE)
+	var root *nwk.Node
+	if useNj {
+		root = util.Nj(dm, false, nil)
+		clampLengths(root)
+	} else {
+		root = util.Upgma(dm, false, nil)
+	}
+	if printTree {
+		labelLeaves(root, seqs)
+		fmt.Println(root)
+		return
+	}
+	pr := progress(root, seqs, mat, gapO, gapE)
+	rows := make([][]byte, len(seqs))
+	for i, id := range pr.ids {
+		rows[id] = pr.rows[i]
+	}
+	for i, seq := range seqs {
+		s := fasta.NewSequence(seq.Header(), rows[i])
+		s.SetLineLength(ll)
+		fmt.Println(s)
+	}
+}
+func distances(seqs []*fasta.Sequence, mat *pal.ScoreMatrix,
+	gapO, gapE float64) *dist.DistMat {
+	n := len(seqs)
+	dm := dist.NewDistMat(n)
+	self := make([]float64, n)
+	for i, seq := range seqs {
+		dm.Names[i] = strconv.Itoa(i)
+		for _, c := range seq.Data() {
+			self[i] += mat.Score(c, c)
+		}
+	}
+	for i := 0; i < n-1; i++ {
+		for j := i + 1; j < n; j++ {
+			al := pal.NewGlobalAlignment(seqs[i], seqs[j], mat, gapO, gapE)
+			al.Align()
+			m := (self[i] + self[j]) / 2.0
+			if m <= 0 {
+				log.Fatalf("self scores of %q and %q aren't positive",
+					seqs[i].Header(), seqs[j].Header())
+			}
+			dm.Matrix[i][j] = 1.0 - al.Score()/m
+			dm.Matrix[j][i] = dm.Matrix[i][j]
+		}
+	}
+	return dm
+}
+func clampLengths(v *nwk.Node) {
+	if v == nil {
+		return
+	}
+	v.Length = math.Max(v.Length, 0.0)
+	clampLengths(v.Child)
+	clampLengths(v.Sib)
+}
+func labelLeaves(v *nwk.Node, seqs []*fasta.Sequence) {
+	if v == nil {
+		return
+	}
+	if v.Child == nil {
+		i, err := strconv.Atoi(v.Label)
+		if err != nil {
+			log.Fatalf("can't convert %q", v.Label)
+		}
+		v.Label = strings.Fields(seqs[i].Header())[0]
+	}
+	labelLeaves(v.Child, seqs)
+	labelLeaves(v.Sib, seqs)
+}
+func progress(v *nwk.Node, seqs []*fasta.Sequence,
+	mat *pal.ScoreMatrix, gapO, gapE float64) *profile {
+	if v.Child == nil {
+		i, err := strconv.Atoi(v.Label)
+		if err != nil {
+			log.Fatalf("can't convert %q", v.Label)
+		}
+		p := new(profile)
+		d := seqs[i].Data()
+		p.rows = append(p.rows, append([]byte{}, d...))
+		p.ids = append(p.ids, i)
+		return p
+	}
+	p := progress(v.Child, seqs, mat, gapO, gapE)
+	for w := v.Child.Sib; w != nil; w = w.Sib {
+		q := progress(w, seqs, mat, gapO, gapE)
+		p = alignProfiles(p, q, mat, gapO, gapE)
+	}
+	return p
+}
+func alignProfiles(a, b *profile, mat *pal.ScoreMatrix,
+	gapO, gapE float64) *profile {
+	m := len(a.rows[0])
+	n := len(b.rows[0])
+	ca := countColumns(a)
+	cb := countColumns(b)
+	inf := math.Inf(-1)
+	M := newMatrix(m+1, n+1, inf)
+	X := newMatrix(m+1, n+1, inf)
+	Y := newMatrix(m+1, n+1, inf)
+	V := newMatrix(m+1, n+1, inf)
+	V[0][0] = 0.0
+	for i := 1; i <= m; i++ {
+		X[i][0] = gapO + float64(i-1)*gapE
+		V[i][0] = X[i][0]
+	}
+	for j := 1; j <= n; j++ {
+		Y[0][j] = gapO + float64(j-1)*gapE
+		V[0][j] = Y[0][j]
+	}
+	for i := 1; i <= m; i++ {
+		for j := 1; j <= n; j++ {
+			M[i][j] = V[i-1][j-1] + colScore(ca[i-1], cb[j-1], mat)
+			X[i][j] = math.Max(V[i-1][j]+gapO, X[i-1][j]+gapE)
+			Y[i][j] = math.Max(V[i][j-1]+gapO, Y[i][j-1]+gapE)
+			V[i][j] = math.Max(M[i][j], math.Max(X[i][j], Y[i][j]))
+		}
+	}
+	c := new(profile)
+	c.ids = append(append(c.ids, a.ids...), b.ids...)
+	c.rows = make([][]byte, len(c.ids))
+	i := m
+	j := n
+	state := maxState(M[i][j], X[i][j], Y[i][j])
+	for i > 0 || j > 0 {
+		if i == 0 {
+			state = stY
+		} else if j == 0 {
+			state = stX
+		}
+		na := len(a.rows)
+		switch state {
+		case stM:
+			appendColumn(c.rows[:na], a.rows, i-1)
+			appendColumn(c.rows[na:], b.rows, j-1)
+			i--
+			j--
+			state = maxState(M[i][j], X[i][j], Y[i][j])
+		case stX:
+			appendColumn(c.rows[:na], a.rows, i-1)
+			appendColumn(c.rows[na:], b.rows, -1)
+			if i > 1 && X[i][j] == X[i-1][j]+gapE {
+				state = stX
+			} else {
+				state = maxState(M[i-1][j], X[i-1][j], Y[i-1][j])
+			}
+			i--
+		case stY:
+			appendColumn(c.rows[:na], a.rows, -1)
+			appendColumn(c.rows[na:], b.rows, j-1)
+			if j > 1 && Y[i][j] == Y[i][j-1]+gapE {
+				state = stY
+			} else {
+				state = maxState(M[i][j-1], X[i][j-1], Y[i][j-1])
+			}
+			j--
+		}
+	}
+	for _, row := range c.rows {
+		for k, l := 0, len(row)-1; k < l; k, l = k+1, l-1 {
+			row[k], row[l] = row[l], row[k]
+		}
+	}
+	return c
+}
+func countColumns(p *profile) [][]count {
+	l := len(p.rows[0])
+	cols := make([][]count, l)
+	for j := 0; j < l; j++ {
+		var c [256]int
+		for _, row := range p.rows {
+			if row[j] != '-' {
+				c[row[j]]++
+			}
+		}
+		for r, x := range c {
+			if x > 0 {
+				cols[j] = append(cols[j], count{byte(r), x})
+			}
+		}
+	}
+	return cols
+}
+func colScore(a, b []count, mat *pal.ScoreMatrix) float64 {
+	s := 0.0
+	na := 0
+	nb := 0
+	for _, x := range a {
+		na += x.n
+	}
+	for _, y := range b {
+		nb += y.n
+	}
+	if na == 0 || nb == 0 {
+		return 0.0
+	}
+	for _, x := range a {
+		for _, y := range b {
+			s += float64(x.n*y.n) * mat.Score(x.r, y.r)
+		}
+	}
+	return s / float64(na*nb)
+}
+func newMatrix(r, c int, x float64) [][]float64 {
+	m := make([][]float64, r)
+	for i := 0; i < r; i++ {
+		m[i] = make([]float64, c)
+		for j := 0; j < c; j++ {
+			m[i][j] = x
+		}
+	}
+	return m
+}
+func maxState(m, x, y float64) int {
+	if m >= x && m >= y {
+		return stM
+	}
+	if x >= y {
+		return stX
+	}
+	return stY
+}
+func appendColumn(dst, src [][]byte, k int) {
+	for i, row := range src {
+		r := byte('-')
+		if k >= 0 {
+			r = row[k]
+		}
+		dst[i] = append(dst[i], r)
+	}
+}
+func main() {
+	util.PrepLog("msa")
+	u := "msa [-h] [option]... [foo.fasta]..."
+	p := "Compute a progressive multiple sequence alignment."
+	e := "msa -m BLOSUM62 prot.fasta"
+	clio.Usage(u, p, e)
+	var optV = flag.Bool("v", false, "version")
+	var optA = flag.Float64("a", 1, "match")
+	var optI = flag.Float64("i", -3, "mismatch")
+	var optM = flag.String("m", "", "file containing score matrix")
+	var optP = flag.Float64("p", -5, "gap opening")
+	var optE = flag.Float64("e", -2, "gap extension")
+	var optN = flag.Bool("n", false, "neighbor-joining guide tree "+
+		"(default UPGMA)")
+	var optT = flag.Bool("t", false, "print guide tree only")
+	var optLL = flag.Int("L", fasta.DefaultLineLength, "line length")
+	flag.Parse()
+	if *optV {
+		util.PrintInfo("msa")
+	}
+	var mat *pal.ScoreMatrix
+	if *optM == "" {
+		mat = pal.NewScoreMatrix(*optA, *optI)
+	} else {
+		f, err := os.Open(*optM)
+		if err != nil {
+			log.Fatalf("couldn't open score matrix %q", *optM)
+		}
+		mat = pal.ReadScoreMatrix(f)
+		f.Close()
+	}
+	files := flag.Args()
+	clio.ParseFiles(files, scan, mat, *optP, *optE, *optN, *optT,
+		*optLL)
+}
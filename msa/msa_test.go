@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"github.com/evolbioinf/fasta"
+	"github.com/evolbioinf/pal"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"testing"
+)
+
+func TestMsa(t *testing.T) {
+	var tests []*exec.Cmd
+	f := "test.fasta"
+	test := exec.Command("./msa", f)
+	tests = append(tests, test)
+	test = exec.Command("./msa", "-n", f)
+	tests = append(tests, test)
+	test = exec.Command("./msa", "-t", f)
+	tests = append(tests, test)
+	for i, test := range tests {
+		get, err := test.Output()
+		if err != nil {
+			t.Errorf("couldn't run %q", test)
+		}
+		f := "r" + strconv.Itoa(i+1) + ".txt"
+		want, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Errorf("couldn't open %q", f)
+		}
+		if !bytes.Equal(get, want) {
+			t.Errorf("get:\n%s\nwant:\n%s\n", get, want)
+		}
+	}
+	mat := pal.NewScoreMatrix(1, -3)
+	gapO, gapE := -5.0, -2.0
+	q := fasta.NewSequence("q", []byte("AAAACCCCGGGGTTTT"))
+	s := fasta.NewSequence("s", []byte("AAAACCCCTTTT"))
+	pq := &profile{rows: [][]byte{append([]byte{}, q.Data()...)},
+		ids: []int{0}}
+	ps := &profile{rows: [][]byte{append([]byte{}, s.Data()...)},
+		ids: []int{1}}
+	pr := alignProfiles(pq, ps, mat, gapO, gapE)
+	sc := 0.0
+	r1, r2 := pr.rows[0], pr.rows[1]
+	for i := range r1 {
+		if r1[i] != '-' && r2[i] != '-' {
+			sc += mat.Score(r1[i], r2[i])
+			continue
+		}
+		r := r1
+		if r2[i] == '-' {
+			r = r2
+		}
+		if i > 0 && r[i-1] == '-' {
+			sc += gapE
+		} else {
+			sc += gapO
+		}
+	}
+	al := pal.NewGlobalAlignment(q, s, mat, gapO, gapE)
+	al.Align()
+	if sc != al.Score() {
+		t.Errorf("msa score: %g; al score: %g", sc, al.Score())
+	}
+}
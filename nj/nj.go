@@ -8,6 +8,8 @@ import (
 	"github.com/evolbioinf/dist"
 	"github.com/evolbioinf/nwk"
 	"io"
+	"log"
+	"math"
 	"os"
 	"text/tabwriter"
 )
@@ -15,110 +17,69 @@ import (
 func scan(r io.Reader, args ...interface{}) {
 	printMat := args[0].(bool)
 	negBr := args[1].(bool)
+	refTrees := args[2].([]*nwk.Node)
+	bionj := args[3].(bool)
+	fit := args[4].(bool)
+	topo := args[5].(*nwk.Node)
+	clades := make(map[string]int)
+	nt := 0
 	sc := dist.NewScanner(r)
 	for sc.Scan() {
 		dm := sc.DistanceMatrix()
 		dm.MakeSymmetrical()
-		r := rowSums(dm)
-		sm := smat(dm, r)
-		var root *nwk.Node
-		n := len(dm.Names)
-		t := make([]*nwk.Node, n)
-		for i := 0; i < n; i++ {
-			t[i] = nwk.NewNode()
-			t[i].Label = dm.Names[i]
+		var om *dist.DistMat
+		if fit {
+			om = copyMat(dm)
 		}
-		for i := n; i > 3; i-- {
+		var root *nwk.Node
+		if topo == nil {
+			var pm func(dm, sm *dist.DistMat, r []float64)
 			if printMat {
-				printMatrices(dm, sm, r)
-			}
-			_, mj, mk := sm.Min()
-			c1 := t[mj]
-			c2 := t[mk]
-			root = nwk.NewNode()
-			l := fmt.Sprintf("(%s,%s)", c1.Label, c2.Label)
-			root.Label = l
-			x := float64(i-2) * dm.Matrix[mj][mk]
-			denom := float64(2 * (i - 2))
-			c1.Length = (x + r[mj] - r[mk]) / denom
-			c2.Length = (x + r[mk] - r[mj]) / denom
-			c1.HasLength = true
-			c2.HasLength = true
-			root.AddChild(c1)
-			root.AddChild(c2)
-			data := make([]float64, i-2)
-			k := 0
-			for j := 0; j < i; j++ {
-				if j == mj || j == mk {
-					continue
-				}
-				data[k] = (dm.Matrix[j][mj] +
-					dm.Matrix[j][mk] - dm.Matrix[mj][mk]) / 2.0
-				k++
+				pm = printMatrices
 			}
-			dm.DeletePair(mj, mk)
-			dm.Append(root.Label, data)
-			k = 0
-			for j := 0; j < i; j++ {
-				if j == mj || j == mk {
-					continue
-				}
-				t[k] = t[j]
-				k++
+			root = util.Nj(dm, bionj, pm)
+		} else {
+			root = copyTree(topo)
+		}
+		if fit {
+			fm := fitLengths(root, om)
+			if printMat {
+				printMatrices(om, fm, deviations(om, fm))
 			}
-			t = t[:k]
-			t = append(t, root)
-			r = rowSums(dm)
-			sm = smat(dm, r)
-		}
-		if printMat {
-			printMatrices(dm, sm, r)
-		}
-		c1 := t[0]
-		c2 := t[1]
-		c3 := t[2]
-		c1.Length = (dm.Matrix[0][1] + dm.Matrix[0][2] -
-			dm.Matrix[1][2]) / 2.0
-		c2.Length = (dm.Matrix[1][0] + dm.Matrix[1][2] -
-			dm.Matrix[0][2]) / 2.0
-		c3.Length = (dm.Matrix[2][0] + dm.Matrix[2][1] -
-			dm.Matrix[0][1]) / 2.0
-		c1.HasLength = true
-		c2.HasLength = true
-		c3.HasLength = true
-		root = nwk.NewNode()
-		root.AddChild(c1)
-		root.AddChild(c2)
-		root.AddChild(c3)
-		resetLabels(root)
+		}
 		if !negBr {
 			correctBranchLengths(root)
 		}
-
-		fmt.Println(root)
+		if len(refTrees) == 0 {
+			fmt.Println(root)
+		} else {
+			util.CountClades(root, clades, true)
+			nt++
+		}
+	}
+	for _, ref := range refTrees {
+		util.AnnotateClades(ref, clades, nt, true)
+		fmt.Println(ref)
 	}
 }
-func rowSums(dm *dist.DistMat) []float64 {
+func copyMat(dm *dist.DistMat) *dist.DistMat {
 	n := len(dm.Names)
-	r := make([]float64, n)
+	cm := dist.NewDistMat(n)
+	copy(cm.Names, dm.Names)
 	for i := 0; i < n; i++ {
-		for j := 0; j < n; j++ {
-			r[i] += dm.Matrix[i][j]
-		}
+		copy(cm.Matrix[i], dm.Matrix[i])
 	}
-	return r
+	return cm
 }
-func smat(dm *dist.DistMat, r []float64) *dist.DistMat {
-	n := len(dm.Names)
-	sm := dist.NewDistMat(n)
-	for i := 0; i < n-1; i++ {
-		for j := i + 1; j < n; j++ {
-			sm.Matrix[i][j] = dm.Matrix[i][j] -
-				(r[i]+r[j])/float64(n-2)
-			sm.Matrix[j][i] = sm.Matrix[i][j]
-		}
+func copyTree(v *nwk.Node) *nwk.Node {
+	c := nwk.NewNode()
+	c.Label = v.Label
+	c.Length = v.Length
+	c.HasLength = v.HasLength
+	for w := v.Child; w != nil; w = w.Sib {
+		c.AddChild(copyTree(w))
 	}
-	return sm
+	return c
 }
 func printMatrices(dm, sm *dist.DistMat, r []float64) {
 	w := tabwriter.NewWriter(os.Stdout, 1, 0, 2, ' ', 0)
@@ -138,16 +99,6 @@ func printMatrices(dm, sm *dist.DistMat, r []float64) {
 	}
 	w.Flush()
 }
-func resetLabels(v *nwk.Node) {
-	if v == nil {
-		return
-	}
-	resetLabels(v.Child)
-	resetLabels(v.Sib)
-	if v.Child != nil {
-		v.Label = ""
-	}
-}
 func correctBranchLengths(v *nwk.Node) {
 	if v == nil {
 		return
@@ -158,20 +109,215 @@ func correctBranchLengths(v *nwk.Node) {
 		v.Length = 0.0
 	}
 }
+func fitLengths(root *nwk.Node, dm *dist.DistMat) *dist.DistMat {
+	nodes := collectNodes(root, nil)
+	rooted := root.Child != nil && root.Child.Sib != nil &&
+		root.Child.Sib.Sib == nil
+	br := make(map[*nwk.Node]int)
+	m := 0
+	for _, v := range nodes {
+		if v == root {
+			continue
+		}
+		if rooted && v == root.Child.Sib {
+			br[v] = br[root.Child]
+			continue
+		}
+		br[v] = m
+		m++
+	}
+	n := len(dm.Names)
+	idx := make(map[string]int)
+	for i, name := range dm.Names {
+		idx[name] = i
+	}
+	leaves := make([]*nwk.Node, n)
+	for _, v := range nodes {
+		if v.Child != nil {
+			continue
+		}
+		i, ok := idx[v.Label]
+		if !ok {
+			log.Fatalf("leaf %q not in distance matrix", v.Label)
+		}
+		leaves[i] = v
+	}
+	for i, v := range leaves {
+		if v == nil {
+			log.Fatalf("taxon %q not in topology", dm.Names[i])
+		}
+	}
+	a := make([][]float64, m)
+	for i := 0; i < m; i++ {
+		a[i] = make([]float64, m)
+	}
+	b := make([]float64, m)
+	dmin := math.MaxFloat64
+	for i := 0; i < n-1; i++ {
+		for j := i + 1; j < n; j++ {
+			d := dm.Matrix[i][j]
+			if d > 0 && d < dmin {
+				dmin = d
+			}
+		}
+	}
+	if dmin == math.MaxFloat64 {
+		dmin = 1.0
+	}
+	for i := 0; i < n-1; i++ {
+		for j := i + 1; j < n; j++ {
+			d := dm.Matrix[i][j]
+			w := 1.0 / (d * d)
+			if d <= 0 {
+				w = 1.0 / (dmin * dmin)
+			}
+			p := path(leaves[i], leaves[j], br)
+			for _, k := range p {
+				b[k] += w * d
+				for _, l := range p {
+					a[k][l] += w
+				}
+			}
+		}
+	}
+	x := solve(a, b)
+	for v, k := range br {
+		v.Length = x[k]
+		v.HasLength = true
+	}
+	fm := dist.NewDistMat(n)
+	copy(fm.Names, dm.Names)
+	for i := 0; i < n-1; i++ {
+		for j := i + 1; j < n; j++ {
+			for _, k := range path(leaves[i], leaves[j], br) {
+				fm.Matrix[i][j] += x[k]
+			}
+			fm.Matrix[j][i] = fm.Matrix[i][j]
+		}
+	}
+	return fm
+}
+func collectNodes(v *nwk.Node, nodes []*nwk.Node) []*nwk.Node {
+	nodes = append(nodes, v)
+	for w := v.Child; w != nil; w = w.Sib {
+		nodes = collectNodes(w, nodes)
+	}
+	return nodes
+}
+func path(u, v *nwk.Node, br map[*nwk.Node]int) []int {
+	anc := make(map[*nwk.Node]bool)
+	for x := u; x != nil; x = x.Parent {
+		anc[x] = true
+	}
+	var p []int
+	x := v
+	for !anc[x] {
+		p = append(p, br[x])
+		x = x.Parent
+	}
+	for y := u; y != x; y = y.Parent {
+		p = append(p, br[y])
+	}
+	return p
+}
+func solve(a [][]float64, b []float64) []float64 {
+	m := len(b)
+	scale := 0.0
+	for _, row := range a {
+		for _, y := range row {
+			scale = math.Max(scale, math.Abs(y))
+		}
+	}
+	for c := 0; c < m; c++ {
+		p := c
+		for r := c + 1; r < m; r++ {
+			if math.Abs(a[r][c]) > math.Abs(a[p][c]) {
+				p = r
+			}
+		}
+		if math.Abs(a[p][c]) <= 1e-12*scale {
+			log.Fatal("branch lengths aren't determined " +
+				"by the distances")
+		}
+		a[c], a[p] = a[p], a[c]
+		b[c], b[p] = b[p], b[c]
+		for r := c + 1; r < m; r++ {
+			f := a[r][c] / a[c][c]
+			for k := c; k < m; k++ {
+				a[r][k] -= f * a[c][k]
+			}
+			b[r] -= f * b[c]
+		}
+	}
+	x := make([]float64, m)
+	for r := m - 1; r >= 0; r-- {
+		y := b[r]
+		for k := r + 1; k < m; k++ {
+			y -= a[r][k] * x[k]
+		}
+		x[r] = y / a[r][r]
+	}
+	return x
+}
+func deviations(dm, fm *dist.DistMat) []float64 {
+	n := len(dm.Names)
+	r := make([]float64, n)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			y := dm.Matrix[i][j] - fm.Matrix[i][j]
+			r[i] += y * y
+		}
+	}
+	return r
+}
 func main() {
 	util.PrepLog("nj")
 	u := "nj [-h] [option]... [foo.dist]..."
-	p := "Calculate neighbor-joining tree."
+	p := "Calculate neighbor-joining or BIONJ tree."
 	e := "nj foo.dist"
 	clio.Usage(u, p, e)
 	var optV = flag.Bool("v", false, "version")
 	var optM = flag.Bool("m", false, "print intermediate "+
 		"matrices")
 	var optN = flag.Bool("n", false, "allow negative branch lengths")
+	var optR = flag.String("r", "", "file of reference tree(s) "+
+		"to annotate with bootstrap support")
+	var optB = flag.Bool("b", false, "BIONJ")
+	var optL = flag.Bool("l", false, "least-squares branch lengths "+
+		"(Fitch-Margoliash)")
+	var optT = flag.String("t", "", "file containing topology for "+
+		"least-squares branch lengths; implies -l")
 	flag.Parse()
 	if *optV {
 		util.PrintInfo("nj")
 	}
+	var refTrees []*nwk.Node
+	if *optR != "" {
+		tf, err := os.Open(*optR)
+		if err != nil {
+			log.Fatalf("couldn't open %q", *optR)
+		}
+		defer tf.Close()
+		sc := nwk.NewScanner(tf)
+		for sc.Scan() {
+			refTrees = append(refTrees, sc.Tree())
+		}
+	}
+	var topo *nwk.Node
+	if *optT != "" {
+		tf, err := os.Open(*optT)
+		if err != nil {
+			log.Fatalf("couldn't open %q", *optT)
+		}
+		defer tf.Close()
+		sc := nwk.NewScanner(tf)
+		if !sc.Scan() {
+			log.Fatalf("couldn't find a tree in %q", *optT)
+		}
+		topo = sc.Tree()
+	}
 	files := flag.Args()
-	clio.ParseFiles(files, scan, *optM, *optN)
+	fit := *optL || topo != nil
+	clio.ParseFiles(files, scan, *optM, *optN, refTrees,
+		*optB, fit, topo)
 }
@@ -8,16 +8,30 @@ import (
 )
 
 func TestNj(t *testing.T) {
+	var tests []*exec.Cmd
 	cmd := exec.Command("./nj", "-m", "test.phy")
-	get, err := cmd.Output()
-	if err != nil {
-		t.Errorf("can't run %q", cmd)
-	}
-	want, err := ioutil.ReadFile("r.txt")
-	if err != nil {
-		t.Errorf("can't open r.txt")
-	}
-	if !bytes.Equal(get, want) {
-		t.Errorf("get:\n%s\nwant:\n%s\n", get, want)
+	tests = append(tests, cmd)
+	cmd = exec.Command("./nj", "-r", "ref.nwk", "boot.phy")
+	tests = append(tests, cmd)
+	cmd = exec.Command("./nj", "-b", "-m", "test2.phy")
+	tests = append(tests, cmd)
+	cmd = exec.Command("./nj", "-l", "-m", "test.phy")
+	tests = append(tests, cmd)
+	cmd = exec.Command("./nj", "-t", "topo.nwk", "test.phy")
+	tests = append(tests, cmd)
+	results := []string{"r.txt", "r2.txt", "r3.txt",
+		"r4.txt", "r5.txt"}
+	for i, cmd := range tests {
+		get, err := cmd.Output()
+		if err != nil {
+			t.Errorf("can't run %q", cmd)
+		}
+		want, err := ioutil.ReadFile(results[i])
+		if err != nil {
+			t.Errorf("can't open %q", results[i])
+		}
+		if !bytes.Equal(get, want) {
+			t.Errorf("get:\n%s\nwant:\n%s\n", get, want)
+		}
 	}
 }
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/evolbioinf/biobox/util"
+	"github.com/evolbioinf/clio"
+	"github.com/evolbioinf/fasta"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+type orf struct {
+	start, end, frame, length int
+	strand                    byte
+	protein                   []byte
+}
+
+func scan(r io.Reader, args ...interface{}) {
+	gc := args[0].(*util.GeneticCode)
+	minLen := args[1].(int)
+	alt := args[2].(bool)
+	pf := args[3].(*os.File)
+	sc := fasta.NewScanner(r)
+	for sc.ScanSequence() {
+		seq := sc.Sequence()
+		var orfs []orf
+		rev := fasta.NewSequence(seq.Header(), seq.Data())
+		rev.ReverseComplement()
+		n := len(seq.Data())
+		for _, frame := range []int{1, 2, 3, -1, -2, -3} {
+			d := seq.Data()
+			f := frame
+			if frame < 0 {
+				d = rev.Data()
+				f *= -1
+			}
+			start := -1
+			for i := f - 1; i < n-2; i += 3 {
+				codon := d[i : i+3]
+				if start < 0 && isStart(codon, gc, alt) {
+					start = i
+				}
+				if gc.Translate(codon) == '*' {
+					if start >= 0 && (i+3-start)/3 >= minLen {
+						o := orf{frame: frame, length: (i + 3 - start) / 3}
+						if frame > 0 {
+							o.start, o.end, o.strand = start+1, i+3, '+'
+						} else {
+							o.start, o.end, o.strand = n-i-2, n-start, '-'
+						}
+						o.protein = []byte{'M'}
+						for j := start + 3; j < i; j += 3 {
+							o.protein = append(o.protein, gc.Translate(d[j:j+3]))
+						}
+						orfs = append(orfs, o)
+					}
+					start = -1
+				}
+			}
+		}
+		sort.SliceStable(orfs, func(i, j int) bool {
+			return orfs[i].start < orfs[j].start
+		})
+		name := ""
+		if fields := strings.Fields(seq.Header()); len(fields) > 0 {
+			name = fields[0]
+		}
+		for i, o := range orfs {
+			fmt.Printf("%d\t%d\t%c\t%d\t%d\t%s\n", o.start, o.end,
+				o.strand, o.frame, o.length, name)
+			if pf != nil {
+				h := fmt.Sprintf("%s_%d %d %d %c %d", name, i+1,
+					o.start, o.end, o.strand, o.frame)
+				fmt.Fprintln(pf, fasta.NewSequence(h, o.protein))
+			}
+		}
+	}
+}
+func isStart(codon []byte, gc *util.GeneticCode, alt bool) bool {
+	if alt {
+		return gc.IsStart(codon)
+	}
+	return string(bytes.ToUpper(codon)) == "ATG"
+}
+func main() {
+	util.PrepLog("orfs")
+	u := "orfs [-h] [option]... [foo.fasta]..."
+	p := "Find open reading frames in DNA sequences."
+	e := "orfs -l 50 foo.fasta | drawGenes | plotLine"
+	clio.Usage(u, p, e)
+	var optV = flag.Bool("v", false, "version")
+	var optL = flag.Int("l", 100, "minimum length in codons")
+	var optA = flag.Bool("a", false, "alternative start codons")
+	var optT = flag.Int("t", 1, "genetic code, see translate -l")
+	var optP = flag.String("p", "", "write proteins to file")
+	flag.Parse()
+	if *optV {
+		util.PrintInfo("orfs")
+	}
+	gc := util.NewGeneticCode(*optT)
+	var pf *os.File
+	if *optP != "" {
+		var err error
+		pf, err = os.Create(*optP)
+		if err != nil {
+			log.Fatalf("couldn't open %q", *optP)
+		}
+		defer pf.Close()
+	}
+	files := flag.Args()
+	clio.ParseFiles(files, scan, gc, *optL, *optA, pf)
+}
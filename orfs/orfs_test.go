@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"testing"
+)
+
+func TestOrfs(t *testing.T) {
+	var tests []*exec.Cmd
+	f := "test.fasta"
+	test := exec.Command("./orfs", "-l", "20", f)
+	tests = append(tests, test)
+	test = exec.Command("./orfs", "-l", "20", "-a", "-t", "11", f)
+	tests = append(tests, test)
+	for i, test := range tests {
+		get, err := test.Output()
+		if err != nil {
+			t.Errorf("couldn't run %q", test)
+		}
+		f := "r" + strconv.Itoa(i+1) + ".txt"
+		want, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Errorf("couldn't read %q", f)
+		}
+		if !bytes.Equal(get, want) {
+			t.Errorf("get:\n%s\nwant:\n%s\n", get, want)
+		}
+	}
+	tmp := "tmp.fasta"
+	test = exec.Command("./orfs", "-l", "20", "-p", tmp, f)
+	err := test.Run()
+	if err != nil {
+		t.Errorf("couldn't run %q", test)
+	}
+	get, err := ioutil.ReadFile(tmp)
+	if err != nil {
+		t.Errorf("couldn't read %q", tmp)
+	}
+	want, err := ioutil.ReadFile("r3.fasta")
+	if err != nil {
+		t.Errorf("couldn't read %q", "r3.fasta")
+	}
+	if !bytes.Equal(get, want) {
+		t.Errorf("get:\n%s\nwant:\n%s\n", get, want)
+	}
+	err = os.Remove(tmp)
+	if err != nil {
+		t.Errorf("couldn't remove %q", tmp)
+	}
+}
@@ -5,8 +5,15 @@
 ./plotTree    -s results/r5.gp -t dumb newick1.nwk
 ./plotTree    -s results/r6.gp newick2.nwk
 ./plotTree    -s results/r7.gp -t dumb newick2.nwk
-for a in $(seq 7)
+./plotTree -r -b -s results/r8.gp newick1.nwk
+./plotTree -u -b -s results/r9.gp newick1.nwk
+./plotTree -r -C '^(One|Two)$' -s results/r10.gp newick1.nwk
+./plotTree -u -M clades.txt -s results/r11.gp newick1.nwk
+./plotTree -r -a -L bottom -s results/r12.gp newick1.nwk
+./plotTree -r -L none -s results/r13.gp newick1.nwk
+for a in $(seq 13)
 do
     sed 's/wxt/qt/' results/r${a}.gp > results/tmp.gp
     mv results/tmp.gp results/r${a}d.gp
 done
+PATH= ./plotTree -r -b -o results/r1.svg newick1.nwk
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"github.com/evolbioinf/biobox/util"
@@ -12,6 +13,7 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
@@ -19,16 +21,26 @@ import (
 
 type opts struct {
 	Rooted, Unrooted, NoLabels bool
-	Ps, Dim                    string
+	Ps, Svg, Dim               string
 	Margin, Scale              float64
 	Script, Win, Code          string
+	Support, Align             bool
+	ScalePos                   string
+	Clades                     []clade
+	SvgCount                   int
 	Title                      string
 }
+type clade struct {
+	re    *regexp.Regexp
+	color string
+}
 type node struct {
 	child, sib, parent *node
 	label              string
 	length             float64
 	hasLength          bool
+	name               string
+	color              string
 	x, y               float64
 	nl                 int
 	tau, omega         float64
@@ -38,12 +50,20 @@ type segment struct {
 	l              string
 	a, h, v        float64
 	o              string
+	c              string
 }
 type dimension struct {
 	xMin, xMax float64
 	yMin, yMax float64
 }
 
+func newClade(r, c string) clade {
+	re, err := regexp.Compile(r)
+	if err != nil {
+		log.Fatalf("couldn't compile %q", r)
+	}
+	return clade{re: re, color: c}
+}
 func scan(r io.Reader, args ...interface{}) {
 	files := args[0].([]string)
 	fileCounter := args[1].(*int)
@@ -54,6 +74,7 @@ func scan(r io.Reader, args ...interface{}) {
 		treeCounter++
 		root := convertTree(sc.Tree())
 		var segments []segment
+		colorClades(root, opts.Clades)
 		rooted := false
 		w := root.child
 		n := 0
@@ -99,14 +120,37 @@ func scan(r io.Reader, args ...interface{}) {
 		height := dim.yMax - dim.yMin
 		y := dim.yMax + height/10.0
 		x2 := x1 - scaleLen
+		if opts.ScalePos == "bottom" {
+			x1 = dim.xMin
+			y = dim.yMin - height/10.0
+			x2 = x1 + scaleLen
+		}
 		s1 := segment{x1: x1, y1: y, x2: x2, y2: y}
-		segments = append(segments, s1)
+		if opts.ScalePos != "none" {
+			segments = append(segments, s1)
+		}
 		x := (x1 + x2) / 2.0
-		y += height / 20.0
+		if opts.ScalePos == "bottom" {
+			y -= height / 20.0
+		} else {
+			y += height / 20.0
+		}
 		l := strconv.FormatFloat(scaleLen, 'g', 3, 64)
 		s1 = segment{x1: x, y1: y, x2: x, y2: y, l: l, o: "c"}
-		segments = append(segments, s1)
-		if opts.Ps != "" {
+		if opts.ScalePos != "none" {
+			segments = append(segments, s1)
+		}
+		if rooted && opts.Align && !opts.NoLabels {
+			x := dim.xMax + width*opts.Margin
+			var leaves []*node
+			leaves = collectLeaves(root, leaves)
+			for _, v := range leaves {
+				s := segment{x1: x, y1: v.y, x2: x, y2: v.y,
+					l: v.label, o: "r"}
+				segments = append(segments, s)
+			}
+		}
+		if opts.Ps != "" || opts.Svg != "" {
 			opts.Title = ""
 		} else {
 			fn := "stdin"
@@ -117,97 +161,160 @@ func scan(r io.Reader, args ...interface{}) {
 			title += "_" + strconv.Itoa(treeCounter)
 			opts.Title = title
 		}
-		var wr io.WriteCloser
-		var gcmd *exec.Cmd
-		var err error
-		if opts.Script == "" {
-			gcmd = exec.Command("gnuplot")
-			wr, err = gcmd.StdinPipe()
-			if err != nil {
-				log.Fatal(err)
-			}
-		} else {
-			wr, err = os.Create(opts.Script)
-			if err != nil {
-				log.Fatal(err)
-			}
-		}
-		done := make(chan struct{})
-		go func() {
-			t := "set terminal"
-			if opts.Ps != "" {
-				t += " postscript eps monochrome"
-			} else {
-				t += " " + opts.Win
+		if opts.Svg != "" {
+			r := &dimension{xMin: 0, xMax: 0, yMin: 0, yMax: 0}
+			for _, s := range segments {
+				r.xMin = math.Min(r.xMin, math.Min(s.x1, s.x2))
+				r.xMax = math.Max(r.xMax, math.Max(s.x1, s.x2))
+				r.yMin = math.Min(r.yMin, math.Min(s.y1, s.y2))
+				r.yMax = math.Max(r.yMax, math.Max(s.y1, s.y2))
 			}
-			if util.IsInteractive(opts.Win) && opts.Ps == "" {
-				t += " persist"
+			xOffset := width * opts.Margin
+			r.xMax = math.Max(r.xMax, dim.xMax+xOffset)
+			if !rooted {
+				yOffset := height * opts.Margin
+				r.yMax = math.Max(r.yMax, height+yOffset)
+				r.yMin = math.Min(r.yMin, dim.yMin-yOffset)
+				r.xMin = math.Min(r.xMin, dim.xMin-xOffset)
 			}
-			t += " size " + opts.Dim
-			fmt.Fprintf(wr, "%s\n", t)
-			if util.IsInteractive(opts.Win) && opts.Ps == "" {
-				c := "set object 1 rectangle from screen 0,0 " +
-					"to screen 1,1 fillcolor rgb 'white' behind"
-				fmt.Fprintf(wr, "%s\n", c)
+			dims := strings.Split(opts.Dim, ",")
+			if len(dims) != 2 {
+				log.Fatalf("can't parse dimensions %q", opts.Dim)
 			}
-			if opts.Ps != "" {
-				fmt.Fprintf(wr, "set output \"%s\"\n", opts.Ps)
+			cw, err := strconv.ParseFloat(dims[0], 64)
+			if err != nil {
+				log.Fatalf("can't parse width %q", dims[0])
 			}
-			if opts.Code != "" {
-				fmt.Fprintf(wr, "# Start of external code\n")
-				fmt.Fprintf(wr, "%s\n", opts.Code)
-				fmt.Fprintf(wr, "# End of external code\n")
+			ch, err := strconv.ParseFloat(dims[1], 64)
+			if err != nil {
+				log.Fatalf("can't parse height %q", dims[1])
 			}
-			fmt.Fprintf(wr, "unset xtics\n")
-			fmt.Fprintf(wr, "unset ytics\n")
-			fmt.Fprintf(wr, "unset border\n")
-			t = "set label \"%s\" %s rotate by %d at %.4g,%.4g front\n"
+			svg := util.NewSVG(cw, ch, r.xMin, r.xMax, r.yMin, r.yMax)
 			for _, s := range segments {
+				if s.x1 != s.x2 || s.y1 != s.y2 {
+					svg.Line(s.x1, s.y1, s.x2, s.y2, s.c, 1.5)
+				}
 				if s.l != "" {
-					a := int(math.Round(s.a))
-					fmt.Fprintf(wr, t, s.l,
-						s.o, a, s.x1, s.y1)
+					l := strings.ReplaceAll(s.l, "\x5c\x5c_", "_")
+					svg.Text(s.x1, s.y1, l, s.o, s.a, s.h, s.v)
 				}
 			}
-			if opts.Title != "" {
-				fmt.Fprintf(wr, "set title \"%s\"\n",
-					opts.Title)
-			}
-			fmt.Fprintf(wr, "plot \"-\" t \"\" w l lc \"black\"")
-			if opts.Ps != "" {
-				fmt.Fprintf(wr, " lw 3")
+			opts.SvgCount++
+			sn := svgName(opts.Svg, opts.SvgCount)
+			err = os.WriteFile(sn, []byte(svg.String()), 0644)
+			if err != nil {
+				log.Fatalf("couldn't write %q", sn)
 			}
-			fmt.Fprintf(wr, "\n")
-			for i, s := range segments {
-				if i > 0 {
-					fmt.Fprintf(wr, "\n")
+		} else {
+			var wr io.WriteCloser
+			var gcmd *exec.Cmd
+			var err error
+			if opts.Script == "" {
+				gcmd = exec.Command("gnuplot")
+				wr, err = gcmd.StdinPipe()
+				if err != nil {
+					log.Fatal(err)
+				}
+			} else {
+				wr, err = os.Create(opts.Script)
+				if err != nil {
+					log.Fatal(err)
 				}
-				fmt.Fprintf(wr, "%.4g %.4g\n%.4g %.4g\n",
-					s.x1, s.y1, s.x2, s.y2)
 			}
-			xOffset := width * opts.Margin
-			x := dim.xMax + xOffset
-			fmt.Fprintf(wr, "\n%.4g 0\n", x)
-			if !rooted {
-				yOffset := height * opts.Margin
-				y := height + yOffset
-				fmt.Fprintf(wr, "\n0 %.4g\n", y)
-				y = dim.yMin - yOffset
-				fmt.Fprintf(wr, "\n0 %.4g\n", y)
-				x = dim.xMin - xOffset
+			done := make(chan struct{})
+			go func() {
+				t := "set terminal"
+				if opts.Ps != "" && len(opts.Clades) > 0 {
+					t += " postscript eps color"
+				} else if opts.Ps != "" {
+					t += " postscript eps monochrome"
+				} else {
+					t += " " + opts.Win
+				}
+				if util.IsInteractive(opts.Win) && opts.Ps == "" {
+					t += " persist"
+				}
+				t += " size " + opts.Dim
+				fmt.Fprintf(wr, "%s\n", t)
+				if util.IsInteractive(opts.Win) && opts.Ps == "" {
+					c := "set object 1 rectangle from screen 0,0 " +
+						"to screen 1,1 fillcolor rgb 'white' behind"
+					fmt.Fprintf(wr, "%s\n", c)
+				}
+				if opts.Ps != "" {
+					fmt.Fprintf(wr, "set output \"%s\"\n", opts.Ps)
+				}
+				if opts.Code != "" {
+					fmt.Fprintf(wr, "# Start of external code\n")
+					fmt.Fprintf(wr, "%s\n", opts.Code)
+					fmt.Fprintf(wr, "# End of external code\n")
+				}
+				fmt.Fprintf(wr, "unset xtics\n")
+				fmt.Fprintf(wr, "unset ytics\n")
+				fmt.Fprintf(wr, "unset border\n")
+				t = "set label \"%s\" %s rotate by %d at %.4g,%.4g%s front\n"
+				for _, s := range segments {
+					if s.l != "" {
+						a := int(math.Round(s.a))
+						off := ""
+						if s.h != 0 || s.v != 0 {
+							off = fmt.Sprintf(" offset %g,%g", s.h, s.v)
+						}
+						fmt.Fprintf(wr, t, s.l,
+							s.o, a, s.x1, s.y1, off)
+					}
+				}
+				if opts.Title != "" {
+					fmt.Fprintf(wr, "set title \"%s\"\n",
+						opts.Title)
+				}
+				fmt.Fprintf(wr, "plot \"-\" t \"\" w l lc \"black\"")
+				lw := ""
+				if opts.Ps != "" {
+					lw = " lw 3"
+				}
+				fmt.Fprintf(wr, "%s", lw)
+				var colors []string
+				seen := make(map[string]bool)
+				for _, s := range segments {
+					if s.c != "" && !seen[s.c] {
+						seen[s.c] = true
+						colors = append(colors, s.c)
+					}
+				}
+				for _, c := range colors {
+					fmt.Fprintf(wr, ", \"-\" t \"\" w l lc \"%s\"%s", c, lw)
+				}
+				fmt.Fprintf(wr, "\n")
+				writeSegments(wr, segments, "")
+				xOffset := width * opts.Margin
+				x := dim.xMax + xOffset
 				fmt.Fprintf(wr, "\n%.4g 0\n", x)
+				if !rooted {
+					yOffset := height * opts.Margin
+					y := height + yOffset
+					fmt.Fprintf(wr, "\n0 %.4g\n", y)
+					y = dim.yMin - yOffset
+					fmt.Fprintf(wr, "\n0 %.4g\n", y)
+					x = dim.xMin - xOffset
+					fmt.Fprintf(wr, "\n%.4g 0\n", x)
+				}
+				for _, c := range colors {
+					fmt.Fprintf(wr, "e\n")
+					writeSegments(wr, segments, c)
+				}
+				wr.Close()
+				done <- struct{}{}
+			}()
+			if opts.Script == "" {
+				out, err := gcmd.Output()
+				util.CheckGnuplot(err)
+				if len(out) > 0 {
+					fmt.Printf("%s", out)
+				}
 			}
-			wr.Close()
-			done <- struct{}{}
-		}()
-		if opts.Script == "" {
-			out, err := gcmd.Output()
-			util.CheckGnuplot(err)
-			if len(out) > 0 {
-				fmt.Printf("%s", out)
-			}
+			<-done
 		}
-		<-done
 	}
 	*fileCounter++
 }
@@ -220,6 +327,7 @@ func cpTree(v *nwk.Node, n *node) {
 	if v == nil {
 		return
 	}
+	n.name = v.Label
 	n.label = strings.ReplaceAll(v.Label,
 		"_", "\x5c\x5c_")
 	n.length = v.Length
@@ -238,6 +346,60 @@ func cpTree(v *nwk.Node, n *node) {
 	cpTree(v.Child, n.child)
 	cpTree(v.Sib, n.sib)
 }
+func colorClades(root *node, clades []clade) {
+	var leaves []*node
+	leaves = collectLeaves(root, leaves)
+	for _, c := range clades {
+		var a *node
+		for _, l := range leaves {
+			if !c.re.MatchString(l.name) {
+				continue
+			}
+			if a == nil {
+				a = l
+			} else {
+				a = lca(a, l)
+			}
+		}
+		if a != nil {
+			setColor(a, c.color)
+		}
+	}
+}
+func collectLeaves(v *node, leaves []*node) []*node {
+	if v == nil {
+		return leaves
+	}
+	if v.child == nil {
+		leaves = append(leaves, v)
+	}
+	leaves = collectLeaves(v.child, leaves)
+	leaves = collectLeaves(v.sib, leaves)
+	return leaves
+}
+func lca(a, b *node) *node {
+	anc := make(map[*node]bool)
+	for v := a; v != nil; v = v.parent {
+		anc[v] = true
+	}
+	for !anc[b] {
+		b = b.parent
+	}
+	return b
+}
+func setColor(v *node, c string) {
+	v.color = c
+	for w := v.child; w != nil; w = w.sib {
+		setColor(w, c)
+	}
+}
+func hasSupport(v *node) bool {
+	if v.child == nil || v.parent == nil {
+		return false
+	}
+	_, err := strconv.ParseFloat(v.name, 64)
+	return err == nil
+}
 func setXcoords(v *node) {
 	if v == nil {
 		return
@@ -290,9 +452,19 @@ func collectBranchesR(v *node, segments []segment,
 			label = " " + v.label
 		}
 		p := v.parent
-		s1 := segment{x1: p.x, y1: p.y, x2: p.x, y2: v.y}
+		if o.Support && hasSupport(v) {
+			label = ""
+			x := (p.x + v.x) / 2.0
+			s := segment{x1: x, y1: v.y, x2: x, y2: v.y,
+				l: v.label, o: "c", v: 0.5}
+			segments = append(segments, s)
+		}
+		if o.Align && v.child == nil {
+			label = ""
+		}
+		s1 := segment{x1: p.x, y1: p.y, x2: p.x, y2: v.y, c: p.color}
 		s2 := segment{x1: v.x, y1: v.y, x2: p.x,
-			y2: v.y, l: label, o: "l"}
+			y2: v.y, l: label, o: "l", c: v.color}
 		segments = append(segments, s1)
 		segments = append(segments, s2)
 	}
@@ -365,8 +537,16 @@ func collectBranchesU(v *node, segments []segment,
 		} else if !o.NoLabels {
 			label = " " + v.label
 		}
+		if o.Support && hasSupport(v) {
+			label = ""
+			x := (p.x + v.x) / 2.0
+			y := (p.y + v.y) / 2.0
+			s := segment{x1: x, y1: y, x2: x, y2: y,
+				l: v.label, o: "c", v: 0.5}
+			segments = append(segments, s)
+		}
 		seg := segment{x1: v.x, y1: v.y, x2: p.x, y2: p.y,
-			l: label, a: a, o: ori}
+			l: label, a: a, o: ori, c: v.color}
 		segments = append(segments, seg)
 	}
 	segments = collectBranchesU(v.child, segments, o)
@@ -392,6 +572,28 @@ func findDim(v *node, d *dimension) {
 	findDim(v.child, d)
 	findDim(v.sib, d)
 }
+func svgName(name string, n int) string {
+	if n == 1 {
+		return name
+	}
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "_" +
+		strconv.Itoa(n) + ext
+}
+func writeSegments(w io.Writer, segments []segment, c string) {
+	i := 0
+	for _, s := range segments {
+		if s.c != c {
+			continue
+		}
+		if i > 0 {
+			fmt.Fprintf(w, "\n")
+		}
+		fmt.Fprintf(w, "%.4g %.4g\n%.4g %.4g\n",
+			s.x1, s.y1, s.x2, s.y2)
+		i++
+	}
+}
 func main() {
 	util.PrepLog("plotTree")
 	u := "plotTree [-h] [option]... [foo.nwk]..."
@@ -402,14 +604,23 @@ func main() {
 	optR := flag.Bool("r", false, "rooted tree (default input)")
 	optU := flag.Bool("u", false, "unrooted tree (default input)")
 	optN := flag.Bool("n", false, "no node labels (default input)")
-	term := util.GetWindow()
-	optT := flag.String("t", term, "terminal, wxt|qt|x11|...")
+	optB := flag.Bool("b", false, "support values on branches")
+	optCC := flag.String("C", "", "color clade of leaves "+
+		"matching regular expression in red")
+	optMM := flag.String("M", "", "file mapping regular "+
+		"expressions to clade colors")
+	optA := flag.Bool("a", false, "right-align tip labels "+
+		"of rooted tree")
+	optLL := flag.String("L", "top", "scale bar, top|bottom|none")
+	optT := flag.String("t", "", "terminal, wxt|qt|x11|... "+
+		"(default interactive)")
 	optP := flag.String("p", "", "encapsulated postscript file")
+	optO := flag.String("o", "", "SVG file, no gnuplot needed")
 	defScrDim := "640,384"
 	defPsDim := "5,3.5"
 	defDumbDim := "79,24"
 	optD := flag.String("d", defScrDim, "plot dimensions; "+
-		"pixels for screen, "+defPsDim+" in for ps, "+
+		"pixels for screen and SVG, "+defPsDim+" in for ps, "+
 		defDumbDim+" char for dumb")
 	optM := flag.Float64("m", 0.2, "margin")
 	optC := flag.Float64("c", 0.0, "scale")
@@ -424,12 +635,50 @@ func main() {
 	opts.Unrooted = *optU
 	opts.NoLabels = *optN
 	opts.Ps = *optP
+	opts.Svg = *optO
 	opts.Dim = *optD
 	opts.Margin = *optM
 	opts.Scale = *optC
 	opts.Script = *optS
 	opts.Win = *optT
 	opts.Code = *optG
+	opts.Support = *optB
+	opts.Align = *optA
+	opts.ScalePos = *optLL
+	sp := opts.ScalePos
+	if sp != "top" && sp != "bottom" && sp != "none" {
+		log.Fatalf("unknown scale position %q", sp)
+	}
+	if *optCC != "" {
+		opts.Clades = append(opts.Clades,
+			newClade(*optCC, "red"))
+	}
+	if *optMM != "" {
+		mf, err := os.Open(*optMM)
+		if err != nil {
+			log.Fatalf("couldn't open %q", *optMM)
+		}
+		defer mf.Close()
+		sc := bufio.NewScanner(mf)
+		for sc.Scan() {
+			line := sc.Text()
+			if len(line) == 0 || line[0] == '#' {
+				continue
+			}
+			fields := strings.Fields(line)
+			if len(fields) != 2 {
+				log.Fatalf("malformed clade line %q", line)
+			}
+			opts.Clades = append(opts.Clades,
+				newClade(fields[0], fields[1]))
+		}
+	}
+	if opts.Ps != "" && opts.Svg != "" {
+		log.Fatal("please choose either postscript or SVG")
+	}
+	if opts.Win == "" && opts.Svg == "" {
+		opts.Win = util.GetWindow()
+	}
 	if opts.Dim == defScrDim {
 		if opts.Ps != "" {
 			opts.Dim = defPsDim
@@ -437,7 +686,9 @@ func main() {
 			opts.Dim = defDumbDim
 		}
 	}
-	util.CheckWindow(opts.Win)
+	if opts.Svg == "" {
+		util.CheckWindow(opts.Win)
+	}
 	files := flag.Args()
 	fileCounter := 0
 	clio.ParseFiles(files, scan, files, &fileCounter, opts)
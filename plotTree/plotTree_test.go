@@ -7,6 +7,7 @@ import (
 	"os/exec"
 	"runtime"
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -33,6 +34,23 @@ func TestPlotTree(t *testing.T) {
 	tests = append(tests, test)
 	test = exec.Command("./plotTree", "-t", "dumb", "-s", g, f)
 	tests = append(tests, test)
+	f = "newick1.nwk"
+	test = exec.Command("./plotTree", "-r", "-b", "-s", g, f)
+	tests = append(tests, test)
+	test = exec.Command("./plotTree", "-u", "-b", "-s", g, f)
+	tests = append(tests, test)
+	test = exec.Command("./plotTree", "-r", "-C", "^(One|Two)$",
+		"-s", g, f)
+	tests = append(tests, test)
+	test = exec.Command("./plotTree", "-u", "-M", "clades.txt",
+		"-s", g, f)
+	tests = append(tests, test)
+	test = exec.Command("./plotTree", "-r", "-a", "-L", "bottom",
+		"-s", g, f)
+	tests = append(tests, test)
+	test = exec.Command("./plotTree", "-r", "-L", "none",
+		"-s", g, f)
+	tests = append(tests, test)
 	for i, test := range tests {
 		err := test.Run()
 		if err != nil {
@@ -55,6 +73,43 @@ func TestPlotTree(t *testing.T) {
 			t.Errorf("get:\n%s\nwant:\n%s\n", get, want)
 		}
 	}
+	test = exec.Command("./plotTree", "-r", "-b", "-o", g,
+		"newick1.nwk")
+	test.Env = []string{"PATH="}
+	err = test.Run()
+	if err != nil {
+		t.Errorf("couldn't run %q", test)
+	}
+	get, err := ioutil.ReadFile(g)
+	if err != nil {
+		t.Errorf("couldn't open %q", g)
+	}
+	want, err := ioutil.ReadFile("results/r1.svg")
+	if err != nil {
+		t.Error("couldn't open results/r1.svg")
+	}
+	if !bytes.Equal(get, want) {
+		t.Errorf("get:\n%s\nwant:\n%s\n", get, want)
+	}
+	test = exec.Command("./plotTree", "-r", "-b", "-o", g,
+		"newick1.nwk", "newick1.nwk")
+	test.Env = []string{"PATH="}
+	err = test.Run()
+	if err != nil {
+		t.Errorf("couldn't run %q", test)
+	}
+	g2 := strings.TrimSuffix(g, ".gp") + "_2.gp"
+	get, err = ioutil.ReadFile(g2)
+	if err != nil {
+		t.Errorf("couldn't open %q", g2)
+	}
+	if !bytes.Equal(get, want) {
+		t.Errorf("get:\n%s\nwant:\n%s\n", get, want)
+	}
+	err = os.Remove(g2)
+	if err != nil {
+		t.Errorf("can't remove %q", g2)
+	}
 	err = os.Remove(g)
 	if err != nil {
 		t.Errorf("can't remove %q", g)
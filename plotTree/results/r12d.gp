@@ -0,0 +1,85 @@
+set terminal x11 persist size 640,384
+set object 1 rectangle from screen 0,0 to screen 1,1 fillcolor rgb 'white' behind
+unset xtics
+unset ytics
+unset border
+set label " 75" l rotate by 0 at 0.6,0.5 front
+set label " 69" l rotate by 0 at 0.5,2.5 front
+set label "0.1" c rotate by 0 at 0.05,-0.6 front
+set label "One" r rotate by 0 at 1.2,0 front
+set label "Two" r rotate by 0 at 1.2,1 front
+set label "Three" r rotate by 0 at 1.2,2 front
+set label "Four" r rotate by 0 at 1.2,3 front
+set label "Five" r rotate by 0 at 1.2,4 front
+set title "newick1_1"
+plot "-" t "" w l lc "black"
+0 2.75
+0 1.5
+
+0.3 1.5
+0 1.5
+
+0.3 1.5
+0.3 0.5
+
+0.6 0.5
+0.3 0.5
+
+0.6 0.5
+0.6 0
+
+0.8 0
+0.6 0
+
+0.6 0.5
+0.6 1
+
+0.9 1
+0.6 1
+
+0.3 1.5
+0.3 2.5
+
+0.5 2.5
+0.3 2.5
+
+0.5 2.5
+0.5 2
+
+1 2
+0.5 2
+
+0.5 2.5
+0.5 3
+
+0.8 3
+0.5 3
+
+0 2.75
+0 4
+
+0.7 4
+0 4
+
+0 -0.4
+0.1 -0.4
+
+0.05 -0.6
+0.05 -0.6
+
+1.2 0
+1.2 0
+
+1.2 1
+1.2 1
+
+1.2 2
+1.2 2
+
+1.2 3
+1.2 3
+
+1.2 4
+1.2 4
+
+1.2 0
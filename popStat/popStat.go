@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/evolbioinf/biobox/util"
+	"github.com/evolbioinf/clio"
+	"github.com/evolbioinf/fasta"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+type column struct {
+	valid     bool
+	eta, etaS int
+	diff      float64
+	minor     int
+}
+type summary struct {
+	sites, s, eta, etaS int
+	pi                  float64
+	sfs                 []int
+}
+type coefficients struct {
+	a1, a2         float64
+	e1, e2         float64
+	uD, vD, uF, vF float64
+}
+
+func scan(r io.Reader, args ...interface{}) {
+	wl := args[0].(int)
+	step := args[1].(int)
+	printSfs := args[2].(bool)
+	var msa [][]byte
+	sc := fasta.NewScanner(r)
+	for sc.ScanSequence() {
+		d := bytes.ToUpper(sc.Sequence().Data())
+		if len(msa) > 0 && len(d) != len(msa[0]) {
+			log.Fatal("sequences not aligned")
+		}
+		msa = append(msa, d)
+	}
+	n := len(msa)
+	if n < 3 {
+		log.Fatal("please use at least three sequences")
+	}
+	l := len(msa[0])
+	cols := make([]column, l)
+	for j := 0; j < l; j++ {
+		var counts [4]int
+		valid := true
+		for i := 0; i < n; i++ {
+			k := strings.IndexByte("ACGT", msa[i][j])
+			if k < 0 {
+				valid = false
+				break
+			}
+			counts[k]++
+		}
+		cols[j].valid = valid
+		if valid {
+			k := 0
+			ss := 0
+			minor := n
+			for _, c := range counts {
+				if c > 0 {
+					k++
+					ss += c * c
+					if c < minor {
+						minor = c
+					}
+				}
+				if c == 1 {
+					cols[j].etaS++
+				}
+			}
+			if k > 1 {
+				cols[j].eta = k - 1
+			} else {
+				cols[j].etaS = 0
+			}
+			cols[j].diff = float64(n*n-ss) / 2.0
+			if k == 2 {
+				cols[j].minor = minor
+			}
+		}
+	}
+	if wl == 0 || wl > l {
+		wl = l
+		step = l
+	}
+	co := newCoefficients(n)
+	w := tabwriter.NewWriter(os.Stdout, 1, 1, 1, ' ', 0)
+	fmt.Fprintf(w, "#Start\tEnd")
+	if printSfs {
+		for i := 1; i <= n/2; i++ {
+			fmt.Fprintf(w, "\txi_%d", i)
+		}
+	} else {
+		fmt.Fprintf(w, "\tSites\tS\tEta\tPi\tThetaW\tD\tD*\tF*")
+	}
+	fmt.Fprintf(w, "\n")
+	for start := 0; start < l; start += step {
+		end := start + wl
+		if end > l {
+			end = l
+		}
+		su := summarize(cols[start:end], n)
+		fmt.Fprintf(w, "%d\t%d", start+1, end)
+		if printSfs {
+			for i := 1; i <= n/2; i++ {
+				fmt.Fprintf(w, "\t%d", su.sfs[i])
+			}
+		} else {
+			s := float64(su.s)
+			eta := float64(su.eta)
+			etaS := float64(su.etaS)
+			nf := float64(n)
+			tw := s / co.a1
+			d := (su.pi - tw) / math.Sqrt(co.e1*s+co.e2*s*(s-1))
+			ds := (nf/(nf-1)*eta - co.a1*etaS) /
+				math.Sqrt(co.uD*eta+co.vD*eta*eta)
+			fs := (su.pi - (nf-1)/nf*etaS) /
+				math.Sqrt(co.uF*eta+co.vF*eta*eta)
+			fmt.Fprintf(w, "\t%d\t%d\t%d\t%.4g\t%.4g\t%s\t%s\t%s",
+				su.sites, su.s, su.eta, su.pi, tw,
+				statistic(d), statistic(ds), statistic(fs))
+		}
+		fmt.Fprintf(w, "\n")
+		if end == l {
+			break
+		}
+	}
+	w.Flush()
+}
+func summarize(cols []column, n int) *summary {
+	su := new(summary)
+	su.sfs = make([]int, n/2+1)
+	for _, c := range cols {
+		if !c.valid {
+			continue
+		}
+		su.sites++
+		if c.eta > 0 {
+			su.s++
+		}
+		su.eta += c.eta
+		su.etaS += c.etaS
+		su.pi += c.diff
+		su.sfs[c.minor]++
+	}
+	su.pi /= float64(n * (n - 1) / 2)
+	return su
+}
+func statistic(x float64) string {
+	if math.IsNaN(x) {
+		return "NA"
+	}
+	return fmt.Sprintf("%.4g", x)
+}
+func newCoefficients(n int) *coefficients {
+	co := new(coefficients)
+	co.a1 = util.HarmonicNumber(n-1, 1)
+	co.a2 = util.HarmonicNumber(n-1, 2)
+	nf := float64(n)
+	a1, a2 := co.a1, co.a2
+	b1 := (nf + 1) / (3 * (nf - 1))
+	b2 := 2 * (nf*nf + nf + 3) / (9 * nf * (nf - 1))
+	c1 := b1 - 1/a1
+	c2 := b2 - (nf+2)/(a1*nf) + a2/(a1*a1)
+	co.e1 = c1 / a1
+	co.e2 = c2 / (a1*a1 + a2)
+	an1 := a1 + 1/nf
+	cn := 2 * (nf*a1 - 2*(nf-1)) / ((nf - 1) * (nf - 2))
+	dn := cn + (nf-2)/((nf-1)*(nf-1)) +
+		2/(nf-1)*(1.5-(2*an1-3)/(nf-2)-1/nf)
+	m := nf / (nf - 1)
+	co.vD = (m*m*a2 + a1*a1*dn -
+		2*nf*a1*(a1+1)/((nf-1)*(nf-1))) /
+		(a1*a1 + a2)
+	co.uD = m*(a1-m) - co.vD
+	co.vF = ((2*nf*nf*nf+110*nf*nf-255*nf+153)/
+		(9*nf*nf*(nf-1)) + 2*(nf-1)*a1/(nf*nf) -
+		8*a2/nf) / (a1*a1 + a2)
+	co.uF = (4*nf*nf+19*nf+3-12*(nf+1)*an1)/
+		(3*nf*(nf-1))/a1 - co.vF
+	return co
+}
+func main() {
+	util.PrepLog("popStat")
+	u := "popStat [-h] [option]... [foo.fasta]..."
+	p := "Compute population genetic summary statistics " +
+		"from alignments."
+	e := "genTree -o fasta | popStat -w 1000"
+	clio.Usage(u, p, e)
+	var optV = flag.Bool("v", false, "version")
+	var optW = flag.Int("w", 0, "window length "+
+		"(default whole alignment)")
+	var optK = flag.Int("k", 0, "step between windows "+
+		"(default window length)")
+	var optF = flag.Bool("f", false, "print folded site frequency "+
+		"spectrum instead of statistics")
+	flag.Parse()
+	if *optV {
+		util.PrintInfo("popStat")
+	}
+	if *optW < 0 || *optK < 0 {
+		log.Fatal("please use non-negative window length and step")
+	}
+	if *optK == 0 {
+		*optK = *optW
+	}
+	files := flag.Args()
+	clio.ParseFiles(files, scan, *optW, *optK, *optF)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"testing"
+)
+
+func TestPopStat(t *testing.T) {
+	var tests []*exec.Cmd
+	test := exec.Command("./popStat", "test.fasta")
+	tests = append(tests, test)
+	test = exec.Command("./popStat", "-w", "300", "-k", "200",
+		"test.fasta")
+	tests = append(tests, test)
+	test = exec.Command("./popStat", "-f", "test.fasta")
+	tests = append(tests, test)
+	test = exec.Command("./popStat", "-f", "-w", "500", "test.fasta")
+	tests = append(tests, test)
+	test = exec.Command("./popStat", "mono.fasta")
+	tests = append(tests, test)
+	test = exec.Command("./popStat", "-w", "100", "-k", "350",
+		"test.fasta")
+	tests = append(tests, test)
+	for i, test := range tests {
+		get, err := test.Output()
+		if err != nil {
+			t.Errorf("couldn't run %q", test)
+		}
+		f := "r" + strconv.Itoa(i+1) + ".txt"
+		want, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Errorf("couldn't open %q", f)
+		}
+		if !bytes.Equal(get, want) {
+			t.Errorf("get:\n%s\nwant:\n%s", get, want)
+		}
+	}
+}
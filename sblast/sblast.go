@@ -9,16 +9,20 @@ import (
 	"github.com/evolbioinf/kt"
 	"io"
 	"log"
+	"math"
+	"math/rand"
 	"os"
 	"sort"
 	"strings"
 	"text/tabwriter"
+	"time"
 )
 
 type Opts struct {
 	a, i, t float64
-	w, s    int
-	n, l    bool
+	w, s, c int
+	n, l, z bool
+	r       *rand.Rand
 }
 type Alignment struct {
 	qs, qe, ss, se int
@@ -92,14 +96,40 @@ func scan(r io.Reader, args ...interface{}) {
 				forward = false
 				a := align(query, subject, opts, forward)
 				alignments = append(alignments, a...)
+				var scores []float64
+				var lambda, k float64
+				if opts.c > 0 {
+					fq := fasta.NewSequence(query.Header(), query.Data())
+					fq.ReverseComplement()
+					best := func(q, s *fasta.Sequence) float64 {
+						return math.Max(maxScore(q, s, opts), maxScore(fq, s, opts))
+					}
+					scores = util.ShuffledScores(query, subject, opts.c, opts.r, best)
+					if !opts.z {
+						m := len(query.Data())
+						n := len(subject.Data())
+						lambda, k = util.KarlinAltschul(scores, m, n)
+					}
+				}
 				qa := strings.Fields(query.Header())[0]
 				sa := strings.Fields(subject.Header())[0]
 				for _, a := range alignments {
 					if !a.forward {
 						a.ss, a.se = a.se, a.ss
 					}
-					fmt.Fprintf(out, "%s\t%s\t%d\t%d\t%d\t%d\t%.1f\n",
+					fmt.Fprintf(out, "%s\t%s\t%d\t%d\t%d\t%d\t%.1f",
 						qa, sa, a.qs+1, a.qe+1, a.ss+1, a.se+1, a.score)
+					if opts.c > 0 && opts.z {
+						z := util.ZScore(a.score, scores)
+						fmt.Fprintf(out, "\t%.2f", z)
+					} else if opts.c > 0 {
+						m := len(query.Data())
+						n := len(subject.Data())
+						e := util.EValue(a.score, lambda, k, m, n)
+						b := util.BitScore(a.score, lambda, k)
+						fmt.Fprintf(out, "\t%.3g\t%.1f", e, b)
+					}
+					fmt.Fprintf(out, "\n")
 				}
 			}
 		}
@@ -115,6 +145,36 @@ func getWords(seq *fasta.Sequence, w int) []string {
 	}
 	return words
 }
+func maxScore(query, subject *fasta.Sequence, opts *Opts) float64 {
+	q := query.Data()
+	s := subject.Data()
+	m := len(q)
+	n := len(s)
+	max := 0.0
+	for d := -m + 1; d < n; d++ {
+		cq, cs := 0, d
+		if d < 0 {
+			cq, cs = -d, 0
+		}
+		score := 0.0
+		for cq < m && cs < n {
+			if q[cq] == s[cs] {
+				score += opts.a
+			} else {
+				score += opts.i
+			}
+			if score < 0 {
+				score = 0
+			}
+			if score > max {
+				max = score
+			}
+			cq++
+			cs++
+		}
+	}
+	return max
+}
 func align(query, subject *fasta.Sequence,
 	opts *Opts, forward bool) []Alignment {
 	var alignments []Alignment
@@ -263,6 +323,12 @@ func main() {
 	var optT = flag.Float64("t", 50.0, "threshold score")
 	var optN = flag.Bool("n", false, "naive matching")
 	var optL = flag.Bool("l", false, "print word list")
+	var optC = flag.Int("c", 0, "number of shuffles for computing "+
+		"significance (default no significance)")
+	var optR = flag.Int("r", 0, "seed for random number generator "+
+		"(default internal)")
+	var optZ = flag.Bool("z", false, "z-score instead of E-value "+
+		"and bit score")
 	var optV = flag.Bool("v", false, "version")
 	flag.Parse()
 	if *optV {
@@ -276,13 +342,35 @@ func main() {
 	opts.t = *optT
 	opts.n = *optN
 	opts.l = *optL
+	opts.c = *optC
+	opts.z = *optZ
+	if opts.z && opts.c < 1 {
+		log.Fatal("please set the number of shuffles " +
+			"for the z-score with -c")
+	}
+	if opts.c > 0 && opts.c < 100 {
+		fmt.Fprintf(os.Stderr, "sblast: %d shuffles give noisy "+
+			"significance estimates, use at least 100\n", opts.c)
+	}
+	if *optR != 0 {
+		opts.r = rand.New(rand.NewSource(int64(*optR)))
+	} else {
+		t := time.Now().UnixNano()
+		opts.r = rand.New(rand.NewSource(t))
+	}
 	files := flag.Args()
 	if len(files) == 0 {
 		log.Fatal("please provide a query")
 	}
 	out := tabwriter.NewWriter(os.Stdout, 2, 1, 2, ' ', 0)
 	if !opts.l {
-		fmt.Fprintf(out, "#qa\tsa\tqs\tqe\tss\tse\tscore\n")
+		fmt.Fprintf(out, "#qa\tsa\tqs\tqe\tss\tse\tscore")
+		if opts.c > 0 && opts.z {
+			fmt.Fprintf(out, "\tz")
+		} else if opts.c > 0 {
+			fmt.Fprintf(out, "\tevalue\tbits")
+		}
+		fmt.Fprintf(out, "\n")
 	} else {
 		fmt.Fprintf(out, "#qa\tn\tword\n")
 	}
@@ -31,6 +31,12 @@ func TestSblast(t *testing.T) {
 	test = exec.Command("./sblast", "-l",
 		"test.fasta", "test.fasta")
 	tests = append(tests, test)
+	test = exec.Command("./sblast", "-c", "5", "-r", "3",
+		"test.fasta", "test.fasta")
+	tests = append(tests, test)
+	test = exec.Command("./sblast", "-c", "5", "-r", "3", "-z",
+		"test.fasta", "test.fasta")
+	tests = append(tests, test)
 	for i, test := range tests {
 		get, err := test.Output()
 		if err != nil {
@@ -8,20 +8,37 @@ import (
 	"github.com/evolbioinf/clio"
 	"github.com/evolbioinf/fasta"
 	"io"
+	"log"
 	"math"
 	"math/rand"
 	"os"
+	"strings"
 	"time"
 )
 
 type opts struct {
-	c, r, R, i, I, e float64
-	p, o, S          bool
+	c, r, R, i, I, e, E, d float64
+	p, o, S, q             bool
+}
+type read struct {
+	seq, qual []byte
+	span      int
+	errors    []string
 }
 
+func createFile(name string) *os.File {
+	f, err := os.Create(name)
+	if err != nil {
+		log.Fatalf("couldn't create %q", name)
+	}
+	return f
+}
 func scan(r io.Reader, args ...interface{}) {
 	op := args[0].(*opts)
 	rn := args[1].(*rand.Rand)
+	w1 := args[2].(*bufio.Writer)
+	w2 := args[3].(*bufio.Writer)
+	wt := args[4].(*bufio.Writer)
 	sc := fasta.NewScanner(r)
 	for sc.ScanSequence() {
 		seq := sc.Sequence()
@@ -34,37 +51,34 @@ func scan(r io.Reader, args ...interface{}) {
 		copy(se[1], seq.Data())
 		cov := int(math.Round(float64(n) * op.c))
 		var ns, rc int
-		w := bufio.NewWriter(os.Stdout)
+		tn := ""
+		if fields := strings.Fields(seq.Header()); len(fields) > 0 {
+			tn = fields[0]
+		}
 		for ns < cov {
 			if op.p {
 				pos := rn.Intn(n)
 				il := int(math.Round(rn.NormFloat64()*op.I + op.i))
 				if pos+il < n || op.o {
 					rc++
-					fmt.Fprintf(w, ">Read%d mate=1\n", rc)
+					h := fmt.Sprintf("Read%d mate=1", rc)
 					rl := int(math.Round(rn.NormFloat64()*op.R + op.r))
 					if rl < 0 {
 						rl *= -1
 					}
-					for i := pos; i < pos+rl; i++ {
-						c := se[0][i%n]
-						c = mutate(c, rn, op.e)
-						fmt.Fprintf(w, "%c", c)
-					}
-					fmt.Fprintf(w, "\n")
+					rd := sequence(se[0], pos, rl, rn, op)
+					writeRead(w1, h, rd, op.q)
+					writeTruth(wt, rc, 1, tn, 0, pos, n, il, rd)
 					ns += rl
-					pos = n - (pos + il - 1)
-					fmt.Fprintf(w, ">Read%d mate=2\n", rc)
+					pos = ((n-pos-il)%n + n) % n
+					h = fmt.Sprintf("Read%d mate=2", rc)
 					rl = int(math.Round(rn.NormFloat64()*op.R + op.r))
 					if rl < 0 {
 						rl *= -1
 					}
-					for i := pos; i < pos+rl; i++ {
-						c := se[1][i%n]
-						c = mutate(c, rn, op.e)
-						fmt.Fprintf(w, "%c", c)
-					}
-					fmt.Fprintf(w, "\n")
+					rd = sequence(se[1], pos, rl, rn, op)
+					writeRead(w2, h, rd, op.q)
+					writeTruth(wt, rc, 2, tn, 1, pos, n, il, rd)
 					ns += rl
 				}
 			} else {
@@ -79,33 +93,100 @@ func scan(r io.Reader, args ...interface{}) {
 				}
 				if pos+rl <= n || op.o {
 					rc++
-					fmt.Fprintf(w, ">Read%d\n", rc)
-					for i := pos; i < pos+rl; i++ {
-						c := se[strand][i%n]
-						c = mutate(c, rn, op.e)
-						fmt.Fprintf(w, "%c", c)
-					}
-					fmt.Fprintf(w, "\n")
+					h := fmt.Sprintf("Read%d", rc)
+					rd := sequence(se[strand], pos, rl, rn, op)
+					writeRead(w1, h, rd, op.q)
+					writeTruth(wt, rc, 0, tn, strand, pos, n, 0, rd)
 					ns += rl
 				}
 			}
 		}
-		w.Flush()
 	}
 }
+func sequence(t []byte, pos, rl int, rn *rand.Rand,
+	op *opts) *read {
+	n := len(t)
+	rd := new(read)
+	i := pos
+	for ; len(rd.seq) < rl; i++ {
+		if i >= n && !op.o {
+			break
+		}
+		c := t[i%n]
+		e := errorRate(len(rd.seq), rl, op)
+		qc := quality(e)
+		if rn.Float64() >= e {
+			rd.seq = append(rd.seq, c)
+			rd.qual = append(rd.qual, qc)
+			continue
+		}
+		ep := len(rd.seq) + 1
+		if op.d > 0 && rn.Float64() < op.d {
+			if rn.Float64() < 0.5 {
+				rd.errors = append(rd.errors, fmt.Sprintf("%dD", ep))
+				continue
+			}
+			rd.errors = append(rd.errors, fmt.Sprintf("%dI", ep))
+			rd.seq = append(rd.seq, dna[rn.Intn(4)])
+			rd.qual = append(rd.qual, qc)
+			i--
+			continue
+		}
+		rd.errors = append(rd.errors, fmt.Sprintf("%dS", ep))
+		rd.seq = append(rd.seq, substitute(c, rn))
+		rd.qual = append(rd.qual, qc)
+	}
+	rd.span = i - pos
+	return rd
+}
 
 const dna = "ACGT"
 
-func mutate(c byte, r *rand.Rand, e float64) byte {
-	if r.Float64() >= e {
-		return c
-	}
+func substitute(c byte, r *rand.Rand) byte {
 	m := dna[r.Intn(4)]
 	for m == c {
 		m = dna[r.Intn(4)]
 	}
 	return m
 }
+func errorRate(j, l int, op *opts) float64 {
+	if l < 2 {
+		return op.e
+	}
+	return op.e + (op.E-op.e)*float64(j)/float64(l-1)
+}
+func quality(e float64) byte {
+	q := 93.0
+	if e > 0 {
+		q = math.Min(math.Round(-10*math.Log10(e)), q)
+	}
+	return byte(q) + 33
+}
+func writeRead(w *bufio.Writer, h string, rd *read, fastq bool) {
+	if fastq {
+		fmt.Fprintf(w, "@%s\n%s\n+\n%s\n", h, rd.seq, rd.qual)
+	} else {
+		fmt.Fprintf(w, ">%s\n%s\n", h, rd.seq)
+	}
+}
+func writeTruth(w *bufio.Writer, rc, mate int, tn string,
+	strand, pos, n, il int, rd *read) {
+	if w == nil {
+		return
+	}
+	start, sc := pos, '+'
+	if strand == 1 {
+		start, sc = n-pos-rd.span, '-'
+	}
+	start = (start%n + n) % n
+	end := (start + rd.span - 1 + n) % n
+	errs := "-"
+	if len(rd.errors) > 0 {
+		errs = strings.Join(rd.errors, ",")
+	}
+	fmt.Fprintf(w, "Read%d\t%d\t%s\t%c\t%d\t%d\t%d\t%s\n",
+		rc, mate, tn, sc, start+1, end+1, il, errs)
+}
 func main() {
 	util.PrepLog("sequencer")
 	u := "sequencer [-h] [option]... [foo.fasta]..."
@@ -125,6 +206,13 @@ func main() {
 	var optO = flag.Bool("o", false, "circular template")
 	var optSS = flag.Bool("S", false, "shredder - forward strand only")
 	var optV = flag.Bool("v", false, "version")
+	var optQ = flag.Bool("q", false, "FASTQ output")
+	var optEE = flag.Float64("E", -1, "error rate at read end "+
+		"(default -e)")
+	var optD = flag.Float64("d", 0, "fraction of errors that are indels")
+	var optF = flag.String("f", "", "prefix of files for paired "+
+		"reads (default interleaved on stdout)")
+	var optT = flag.String("t", "", "file of true read origins")
 	flag.Parse()
 	if *optV {
 		util.PrintInfo("sequencer")
@@ -144,6 +232,39 @@ func main() {
 	op.p = *optP
 	op.o = *optO
 	op.S = *optSS
+	op.q = *optQ
+	op.d = *optD
+	op.E = *optEE
+	if op.E < 0 {
+		op.E = op.e
+	}
+	w1 := bufio.NewWriter(os.Stdout)
+	w2 := w1
+	if op.p && *optF != "" {
+		ext := ".fasta"
+		if op.q {
+			ext = ".fastq"
+		}
+		f1 := createFile(*optF + "_R1" + ext)
+		defer f1.Close()
+		f2 := createFile(*optF + "_R2" + ext)
+		defer f2.Close()
+		w1 = bufio.NewWriter(f1)
+		w2 = bufio.NewWriter(f2)
+	}
+	var wt *bufio.Writer
+	if *optT != "" {
+		ft := createFile(*optT)
+		defer ft.Close()
+		wt = bufio.NewWriter(ft)
+		fmt.Fprintf(wt, "#read\tmate\ttemplate\tstrand\t"+
+			"start\tend\tinsert\terrors\n")
+	}
 	files := flag.Args()
-	clio.ParseFiles(files, scan, op, rn)
+	clio.ParseFiles(files, scan, op, rn, w1, w2, wt)
+	w1.Flush()
+	w2.Flush()
+	if wt != nil {
+		wt.Flush()
+	}
 }
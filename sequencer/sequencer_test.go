@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"io/ioutil"
+	"os"
 	"os/exec"
 	"strconv"
 	"testing"
@@ -19,6 +20,9 @@ func TestSequencer(t *testing.T) {
 	tests = append(tests, test)
 	test = exec.Command("./sequencer", "-s", "3", "-r", "50", f)
 	tests = append(tests, test)
+	test = exec.Command("./sequencer", "-s", "3", "-q", "-E", "0.05",
+		"-d", "0.2", f)
+	tests = append(tests, test)
 	for i, test := range tests {
 		get, err := test.Output()
 		if err != nil {
@@ -33,4 +37,26 @@ func TestSequencer(t *testing.T) {
 			t.Errorf("get:\n%s\nwant:\n%s", get, want)
 		}
 	}
+	test = exec.Command("./sequencer", "-s", "3", "-p", "-q",
+		"-f", "tmp", "-t", "tmp.txt", "-e", "0.01", "test.fasta")
+	err := test.Run()
+	if err != nil {
+		t.Errorf("can't run %q", test)
+	}
+	gets := []string{"tmp_R1.fastq", "tmp_R2.fastq", "tmp.txt"}
+	wants := []string{"r6.fastq", "r7.fastq", "r8.txt"}
+	for i, g := range gets {
+		get, err := ioutil.ReadFile(g)
+		if err != nil {
+			t.Errorf("can't open %q", g)
+		}
+		want, err := ioutil.ReadFile(wants[i])
+		if err != nil {
+			t.Errorf("can't open %q", wants[i])
+		}
+		if !bytes.Equal(get, want) {
+			t.Errorf("get:\n%s\nwant:\n%s", get, want)
+		}
+		os.Remove(g)
+	}
 }
@@ -7,24 +7,55 @@ import (
 	"github.com/evolbioinf/clio"
 	"github.com/evolbioinf/nwk"
 	"io"
+	"log"
 	"math/rand"
 	"time"
 )
 
 func parse(r io.Reader, args ...interface{}) {
 	n := args[0].(int)
+	m := args[1].(string)
+	k := args[2].(int)
 	sc := nwk.NewScanner(r)
 	for sc.Scan() {
 		tree := sc.Tree()
 		labels := []string{}
 		labels = extractLabels(tree, labels)
-		for i := 0; i < n; i++ {
-			rand.Shuffle(len(labels), func(i, j int) {
-				labels[i], labels[j] = labels[j], labels[i]
-			})
-			l := 0
-			l = relabelLeaves(tree, labels, l)
-			fmt.Println(tree)
+		switch m {
+		case "shuffle":
+			for i := 0; i < n; i++ {
+				rand.Shuffle(len(labels), func(i, j int) {
+					labels[i], labels[j] = labels[j], labels[i]
+				})
+				l := 0
+				l = relabelLeaves(tree, labels, l)
+				fmt.Println(tree)
+			}
+		case "yule", "pda":
+			if len(labels) < 2 {
+				log.Fatal("please use a tree with at least two leaves")
+			}
+			for i := 0; i < n; i++ {
+				var t *nwk.Node
+				if m == "yule" {
+					t = yule(labels)
+				} else {
+					t = pda(labels)
+				}
+				fmt.Println(t)
+			}
+		case "nni", "spr":
+			for i := 0; i < n; i++ {
+				t := copyTree(tree)
+				for j := 0; j < k; j++ {
+					if m == "nni" {
+						nni(t)
+					} else {
+						t = spr(t)
+					}
+				}
+				fmt.Println(t)
+			}
 		}
 	}
 }
@@ -49,15 +80,185 @@ func relabelLeaves(v *nwk.Node, labels []string, l int) int {
 	}
 	return l
 }
+func yule(labels []string) *nwk.Node {
+	root := nwk.NewNode()
+	leaves := []*nwk.Node{nwk.NewNode(), nwk.NewNode()}
+	root.AddChild(leaves[0])
+	root.AddChild(leaves[1])
+	for len(leaves) < len(labels) {
+		i := rand.Intn(len(leaves))
+		v := leaves[i]
+		c1 := nwk.NewNode()
+		c2 := nwk.NewNode()
+		v.AddChild(c1)
+		v.AddChild(c2)
+		leaves[i] = c1
+		leaves = append(leaves, c2)
+	}
+	rand.Shuffle(len(labels), func(i, j int) {
+		labels[i], labels[j] = labels[j], labels[i]
+	})
+	for i, leaf := range leaves {
+		leaf.Label = labels[i]
+	}
+	return root
+}
+func pda(labels []string) *nwk.Node {
+	root := nwk.NewNode()
+	nodes := []*nwk.Node{root}
+	for i := 0; i < 2; i++ {
+		v := nwk.NewNode()
+		v.Label = labels[i]
+		root.AddChild(v)
+		nodes = append(nodes, v)
+	}
+	for i := 2; i < len(labels); i++ {
+		v := nodes[rand.Intn(len(nodes))]
+		l := nwk.NewNode()
+		l.Label = labels[i]
+		u := insertAbove(v, l)
+		if v == root {
+			root = u
+		}
+		nodes = append(nodes, u, l)
+	}
+	return root
+}
+func insertAbove(v, l *nwk.Node) *nwk.Node {
+	u := nwk.NewNode()
+	if v.Parent != nil {
+		replace(v, u)
+	}
+	if v.HasLength {
+		v.Length /= 2
+		u.Length = v.Length
+		u.HasLength = true
+	}
+	u.AddChild(v)
+	u.AddChild(l)
+	return u
+}
+func replace(v, u *nwk.Node) {
+	p := v.Parent
+	u.Parent = p
+	u.Sib = v.Sib
+	if p.Child == v {
+		p.Child = u
+	} else {
+		w := p.Child
+		for w.Sib != v {
+			w = w.Sib
+		}
+		w.Sib = u
+	}
+	v.Parent = nil
+	v.Sib = nil
+}
+func copyTree(v *nwk.Node) *nwk.Node {
+	w := nwk.NewNode()
+	w.Label = v.Label
+	w.Length = v.Length
+	w.HasLength = v.HasLength
+	for c := v.Child; c != nil; c = c.Sib {
+		w.AddChild(copyTree(c))
+	}
+	return w
+}
+func nni(root *nwk.Node) {
+	var nodes []*nwk.Node
+	nodes = collectNodes(root, nodes)
+	var internal []*nwk.Node
+	for _, v := range nodes {
+		if v.Child != nil && v.Parent != nil {
+			internal = append(internal, v)
+		}
+	}
+	if len(internal) == 0 {
+		log.Fatal("no internal branch for NNI")
+	}
+	v := internal[rand.Intn(len(internal))]
+	var sibs []*nwk.Node
+	for w := v.Parent.Child; w != nil; w = w.Sib {
+		if w != v {
+			sibs = append(sibs, w)
+		}
+	}
+	s := sibs[rand.Intn(len(sibs))]
+	var children []*nwk.Node
+	for w := v.Child; w != nil; w = w.Sib {
+		children = append(children, w)
+	}
+	c := children[rand.Intn(len(children))]
+	x := nwk.NewNode()
+	replace(s, x)
+	replace(c, s)
+	replace(x, c)
+}
+func collectNodes(v *nwk.Node, nodes []*nwk.Node) []*nwk.Node {
+	nodes = append(nodes, v)
+	for c := v.Child; c != nil; c = c.Sib {
+		nodes = collectNodes(c, nodes)
+	}
+	return nodes
+}
+func spr(root *nwk.Node) *nwk.Node {
+	var nodes []*nwk.Node
+	nodes = collectNodes(root, nodes)
+	n := 0
+	for _, v := range nodes {
+		if v.Child == nil {
+			n++
+		}
+	}
+	if n < 3 {
+		log.Fatal("please use a tree with at least three " +
+			"leaves for SPR")
+	}
+	v := nodes[1+rand.Intn(len(nodes)-1)]
+	p := v.Parent
+	p.RemoveChild(v)
+	var s *nwk.Node
+	if p.Child.Sib == nil {
+		s = p.Child
+		p.Child = nil
+		s.Parent = nil
+		if p == root {
+			root = s
+		} else {
+			replace(p, s)
+			s.Length += p.Length
+		}
+	}
+	nodes = nodes[:0]
+	nodes = collectNodes(root, nodes)
+	var targets []*nwk.Node
+	for _, w := range nodes {
+		if w != s || s == root {
+			targets = append(targets, w)
+		}
+	}
+	w := targets[rand.Intn(len(targets))]
+	u := insertAbove(w, v)
+	if w == root {
+		root = u
+	}
+	return root
+}
 func main() {
 	util.PrepLog("shuphyl")
 	u := "shuphyl [-h] [options] [trees]"
-	p := "The phogram shuphyl shuffles the leaf labels of phylogenies"
+	p := "The phogram shuphyl shuffles the leaf labels " +
+		"of phylogenies, generates random trees, or takes " +
+		"random walks in tree space"
 	e := "shuphyl -n 10 foo.nwk"
 	clio.Usage(u, p, e)
 	optV := flag.Bool("v", false, "version")
 	optN := flag.Int("n", 1, "number of iterations")
-	optS := flag.Int("s", 0, "seed of random number generator (default internal)")
+	optS := flag.Int("s", 0, "seed of random number generator "+
+		"(default internal)")
+	optM := flag.String("m", "shuffle", "null model, "+
+		"shuffle|yule|pda|nni|spr")
+	optK := flag.Int("k", 1, "number of moves with -m nni|spr")
 	flag.Parse()
 	if *optV {
 		util.PrintInfo("shuphyl")
@@ -67,6 +268,14 @@ func main() {
 		seed = time.Now().UnixNano()
 	}
 	rand.Seed(seed)
+	m := *optM
+	if m != "shuffle" && m != "yule" && m != "pda" &&
+		m != "nni" && m != "spr" {
+		log.Fatalf("unknown null model %q", m)
+	}
+	if *optK < 0 {
+		log.Fatal("please use a non-negative number of moves")
+	}
 	files := flag.Args()
-	clio.ParseFiles(files, parse, *optN)
+	clio.ParseFiles(files, parse, *optN, m, *optK)
 }
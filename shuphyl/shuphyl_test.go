@@ -15,6 +15,15 @@ func TestShuphyl(t *testing.T) {
 	tests = append(tests, test)
 	test = exec.Command("./shuphyl", "-s", "1", "-n", "2", f)
 	tests = append(tests, test)
+	f = "test2.nwk"
+	for _, m := range []string{"yule", "pda", "nni", "spr"} {
+		test = exec.Command("./shuphyl", "-s", "1", "-n", "3",
+			"-m", m, "-k", "2", f)
+		tests = append(tests, test)
+	}
+	test = exec.Command("./shuphyl", "-s", "1", "-n", "10",
+		"-m", "spr", "test3.nwk")
+	tests = append(tests, test)
 	for i, test := range tests {
 		get, err := test.Output()
 		if err != nil {
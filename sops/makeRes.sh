@@ -2,3 +2,7 @@
 ./sops -i -2 test.fasta > r2.txt
 ./sops -g -1 test.fasta > r3.txt
 ./sops -m sm.txt test.fasta > r4.txt
+./sops -c msa.fasta > r5.txt
+./sops -p -5 msa.fasta > r6.txt
+./sops -t msa.nwk msa.fasta > r7.txt
+./sops -w weights.txt msa.fasta > r8.txt
@@ -1,24 +1,60 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"github.com/evolbioinf/biobox/util"
 	"github.com/evolbioinf/clio"
 	"github.com/evolbioinf/fasta"
+	"github.com/evolbioinf/nwk"
 	"github.com/evolbioinf/pal"
 	"io"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 )
 
+func treeWeights(v *nwk.Node, w float64,
+	weights map[string]float64) int {
+	if v.Child == nil {
+		weights[v.Label] = w + v.Length
+		return 1
+	}
+	n := numLeaves(v)
+	w += v.Length / float64(n)
+	for c := v.Child; c != nil; c = c.Sib {
+		treeWeights(c, w, weights)
+	}
+	return n
+}
+func numLeaves(v *nwk.Node) int {
+	if v.Child == nil {
+		return 1
+	}
+	n := 0
+	for c := v.Child; c != nil; c = c.Sib {
+		n += numLeaves(c)
+	}
+	return n
+}
 func scan(r io.Reader, args ...interface{}) {
 	mat := args[0].(*pal.ScoreMatrix)
 	g := args[1].(float64)
+	gapO := args[2].(float64)
+	weights := args[3].(map[string]float64)
+	perCol := args[4].(bool)
 	sc := fasta.NewScanner(r)
 	var msa [][]byte
+	var names []string
 	for sc.ScanSequence() {
-		msa = append(msa, sc.Sequence().Data())
+		seq := sc.Sequence()
+		msa = append(msa, seq.Data())
+		names = append(names, strings.Fields(seq.Header())[0])
+	}
+	if len(msa) == 0 {
+		return
 	}
 	for i := 1; i < len(msa); i++ {
 		l1 := len(msa[i-1])
@@ -30,26 +66,76 @@ func scan(r io.Reader, args ...interface{}) {
 			log.Fatalf(m, i, l1, i+1, l2)
 		}
 	}
+	w := make([]float64, len(msa))
+	for i := range w {
+		w[i] = 1.0
+	}
+	if weights != nil {
+		sum := 0.0
+		for i, name := range names {
+			x, ok := weights[name]
+			if !ok {
+				log.Fatalf("no weight for %q", name)
+			}
+			w[i] = x
+			sum += x
+		}
+		if sum <= 0 {
+			log.Fatal("weights should sum to a positive number")
+		}
+		for i := range w {
+			w[i] *= float64(len(w)) / sum
+		}
+	}
 	m := len(msa)
 	n := len(msa[0])
-	s := 0.0
-	for i := 0; i < n; i++ {
-		for j := 0; j < m-1; j++ {
-			for k := j + 1; k < m; k++ {
+	cols := make([]float64, n)
+	for j := 0; j < m-1; j++ {
+		for k := j + 1; k < m; k++ {
+			wjk := w[j] * w[k]
+			inJ := false
+			inK := false
+			for i := 0; i < n; i++ {
 				r1 := msa[j][i]
 				r2 := msa[k][i]
 				if r1 == '-' && r2 == '-' {
 					continue
 				}
-				if r1 == '-' || r2 == '-' {
-					s += g
+				x := 0.0
+				if r1 == '-' {
+					x = gapO
+					if inJ {
+						x = g
+					}
+					inJ = true
+					inK = false
+				} else if r2 == '-' {
+					x = gapO
+					if inK {
+						x = g
+					}
+					inK = true
+					inJ = false
 				} else {
-					s += mat.Score(r1, r2)
+					x = mat.Score(r1, r2)
+					inJ = false
+					inK = false
 				}
+				cols[i] += wjk * x
 			}
 		}
 	}
-	fmt.Printf("sum-of-pairs_score\t%g\n", s)
+	if perCol {
+		for i, x := range cols {
+			fmt.Printf("%d\t%g\n", i+1, x)
+		}
+	} else {
+		s := 0.0
+		for _, x := range cols {
+			s += x
+		}
+		fmt.Printf("sum-of-pairs_score\t%g\n", s)
+	}
 }
 
 func main() {
@@ -62,7 +148,13 @@ func main() {
 	var optA = flag.Float64("a", 1, "match")
 	var optI = flag.Float64("i", -3, "mismatch")
 	var optM = flag.String("m", "", "score matrix")
-	var optG = flag.Float64("g", -2, "gap")
+	var optG = flag.Float64("g", -2, "gap (extension)")
+	var optP = flag.Float64("p", -2, "gap opening (default -g, "+
+		"linear gaps)")
+	var optC = flag.Bool("c", false, "per-column scores as x/y data")
+	var optW = flag.String("w", "", "file of sequence weights "+
+		"(name weight)")
+	var optT = flag.String("t", "", "tree file for sequence weights")
 	flag.Parse()
 	if *optV {
 		util.PrintInfo("sops")
@@ -79,6 +171,52 @@ func main() {
 		defer f.Close()
 		mat = pal.ReadScoreMatrix(f)
 	}
-	f := flag.Args()
-	clio.ParseFiles(f, scan, mat, *optG)
+	gapO := *optG
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "p" {
+			gapO = *optP
+		}
+	})
+	var weights map[string]float64
+	if *optW != "" && *optT != "" {
+		log.Fatal("please use either -w or -t")
+	}
+	if *optW != "" {
+		f, err := os.Open(*optW)
+		if err != nil {
+			log.Fatalf("couldn't open %q", *optW)
+		}
+		weights = make(map[string]float64)
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			fields := strings.Fields(sc.Text())
+			if len(fields) == 0 || fields[0][0] == '#' {
+				continue
+			}
+			if len(fields) != 2 {
+				log.Fatalf("expecting name and weight, "+
+					"but got %q", sc.Text())
+			}
+			x, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil {
+				log.Fatalf("can't convert %q", fields[1])
+			}
+			weights[fields[0]] = x
+		}
+		f.Close()
+	} else if *optT != "" {
+		f, err := os.Open(*optT)
+		if err != nil {
+			log.Fatalf("couldn't open %q", *optT)
+		}
+		sc := nwk.NewScanner(f)
+		if !sc.Scan() {
+			log.Fatalf("couldn't find a tree in %q", *optT)
+		}
+		weights = make(map[string]float64)
+		treeWeights(sc.Tree(), 0.0, weights)
+		f.Close()
+	}
+	files := flag.Args()
+	clio.ParseFiles(files, scan, mat, *optG, gapO, weights, *optC)
 }
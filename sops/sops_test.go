@@ -19,6 +19,15 @@ func TestSops(t *testing.T) {
 	tests = append(tests, test)
 	test = exec.Command("./sops", "-m", "sm.txt", f)
 	tests = append(tests, test)
+	f = "msa.fasta"
+	test = exec.Command("./sops", "-c", f)
+	tests = append(tests, test)
+	test = exec.Command("./sops", "-p", "-5", f)
+	tests = append(tests, test)
+	test = exec.Command("./sops", "-t", "msa.nwk", f)
+	tests = append(tests, test)
+	test = exec.Command("./sops", "-w", "weights.txt", f)
+	tests = append(tests, test)
 	for i, test := range tests {
 		get, err := test.Output()
 		if err != nil {
@@ -8,65 +8,91 @@ import (
 	"github.com/evolbioinf/fasta"
 	"io"
 	"log"
+	"os"
 )
 
 func scan(r io.Reader, args ...interface{}) {
-	gc := args[0].(map[string]byte)
-	frame := args[1].(int)
+	gc := args[0].(*util.GeneticCode)
+	frames := args[1].([]int)
+	optM := args[2].(bool)
+	optR := args[3].(bool)
+	optP := args[4].(bool)
 	sc := fasta.NewScanner(r)
 	for sc.ScanSequence() {
 		seq := sc.Sequence()
-		if frame < 0 {
-			seq.ReverseComplement()
-			frame *= -1
-		}
-		d := seq.Data()
-		var aa []byte
-		for i := frame - 1; i < len(seq.Data())-2; i += 3 {
-			codon := string(d[i : i+3])
-			aa = append(aa, gc[codon])
+		rev := fasta.NewSequence(seq.Header(), seq.Data())
+		rev.ReverseComplement()
+		for _, frame := range frames {
+			d := seq.Data()
+			f := frame
+			if frame < 0 {
+				d = rev.Data()
+				f *= -1
+			}
+			var aa []byte
+			for i := f - 1; i < len(d)-2; i += 3 {
+				codon := d[i : i+3]
+				if optM && i == f-1 && gc.IsStart(codon) {
+					aa = append(aa, 'M')
+				} else {
+					aa = append(aa, gc.Translate(codon))
+				}
+			}
+			if r := (len(d) - f + 1) % 3; r > 0 && len(d) >= f {
+				partial := d[len(d)-r:]
+				if optR {
+					fmt.Fprintf(os.Stderr, "%s, frame %d: partial "+
+						"codon %q\n", seq.Header(), frame, partial)
+				}
+				if optP {
+					codon := append([]byte{}, partial...)
+					for len(codon) < 3 {
+						codon = append(codon, 'N')
+					}
+					aa = append(aa, gc.Translate(codon))
+				}
+			}
+			h := seq.Header() + " - translated"
+			if len(frames) > 1 {
+				h += fmt.Sprintf(", frame %d", frame)
+			}
+			aaSeq := fasta.NewSequence(h, aa)
+			fmt.Println(aaSeq)
 		}
-		h := seq.Header() + " - translated"
-		aaSeq := fasta.NewSequence(h, aa)
-		fmt.Println(aaSeq)
 	}
 }
 func main() {
 	util.PrepLog("translate")
 	u := "translate [-h] [option]... [foo.fasta]..."
 	p := "Translate DNA sequences."
-	e := "translate -f 2 foo.fasta"
+	e := "translate -t 11 -a foo.fasta"
 	clio.Usage(u, p, e)
 	var optF = flag.Int("f", 1, "reading frame -3|-2|-1|1|2|3")
 	var optV = flag.Bool("v", false, "version")
+	var optA = flag.Bool("a", false, "all six reading frames")
+	var optT = flag.Int("t", 1, "genetic code, see -l")
+	var optL = flag.Bool("l", false, "list genetic codes")
+	var optM = flag.Bool("m", false, "translate start codons as M")
+	var optR = flag.Bool("r", false, "report partial codons")
+	var optP = flag.Bool("p", false, "pad partial codons with N")
 	flag.Parse()
 	if *optV {
 		util.PrintInfo("tranlate")
 	}
-	if *optF < -3 || *optF > 3 {
+	if *optL {
+		fmt.Print(util.GeneticCodes())
+		os.Exit(0)
+	}
+	if *optF < -3 || *optF > 3 || *optF == 0 {
 		m := "please use a reading frame " +
 			"between -3 and 3"
 		log.Fatal(m)
 	}
-	gc := make(map[string]byte)
-	dna := "TCAG"
-	aa := "FFLLSSSSYY**CC*W" +
-		"LLLLPPPPHHQQRRRR" +
-		"IIIMTTTTNNKKSSRR" +
-		"VVVVAAAADDEEGGGG"
-	codon := make([]byte, 3)
-	n := 0
-	for i := 0; i < 4; i++ {
-		for j := 0; j < 4; j++ {
-			for k := 0; k < 4; k++ {
-				codon[0] = dna[i]
-				codon[1] = dna[j]
-				codon[2] = dna[k]
-				gc[string(codon)] = aa[n]
-				n++
-			}
-		}
+	frames := []int{*optF}
+	if *optA {
+		frames = []int{1, 2, 3, -1, -2, -3}
 	}
+	gc := util.NewGeneticCode(*optT)
 	files := flag.Args()
-	clio.ParseFiles(files, scan, gc, *optF)
+	clio.ParseFiles(files, scan, gc, frames, *optM, *optR, *optP)
 }
@@ -25,6 +25,22 @@ func TestTranslate(t *testing.T) {
 	tests = append(tests, test)
 	test = exec.Command("./translate", "-f", "-3", f)
 	tests = append(tests, test)
+	test = exec.Command("./translate", "-a", f)
+	tests = append(tests, test)
+	test = exec.Command("./translate", "-a", "-t", "2", f)
+	tests = append(tests, test)
+	f = "t2.fasta"
+	test = exec.Command("./translate", "-t", "11", f)
+	tests = append(tests, test)
+	test = exec.Command("./translate", "-t", "11", "-m", f)
+	tests = append(tests, test)
+	test = exec.Command("./translate", "-m", f)
+	tests = append(tests, test)
+	f = "t3.fasta"
+	test = exec.Command("./translate", f)
+	tests = append(tests, test)
+	test = exec.Command("./translate", "-p", f)
+	tests = append(tests, test)
 	for i, test := range tests {
 		get, err := test.Output()
 		if err != nil {
@@ -9,38 +9,218 @@ import (
 	"io"
 	"log"
 	"os"
+	"regexp"
+	"sort"
+	"strconv"
 	"text/tabwriter"
 )
 
+type editParams struct {
+	prune, sub            *regexp.Regexp
+	minLen, minSup, scale float64
+	ladder, edit, depth   bool
+}
+
 func scan(r io.Reader, args ...interface{}) {
 	io := args[0].(bool)
 	po := args[1].(bool)
 	out := args[2].(*tabwriter.Writer)
 	first := args[3].(*bool)
+	ep := args[4].(*editParams)
+	tab := args[5].(bool)
 	sc := nwk.NewScanner(r)
 	for sc.Scan() {
+		root := sc.Tree()
+		if ep.sub != nil {
+			root = subtree(root, ep.sub)
+		}
+		if ep.prune != nil {
+			root = prune(root, ep.prune)
+		}
+		if ep.minLen > 0 {
+			collapseShort(root, ep.minLen)
+		}
+		if ep.minSup > 0 {
+			collapseWeak(root, ep.minSup)
+		}
+		if ep.ladder {
+			ladderize(root)
+		}
+		if ep.scale != 1 {
+			rescale(root, ep.scale)
+		}
+		if ep.edit && !tab && !ep.depth {
+			fmt.Println(root)
+			continue
+		}
 		if *first {
 			*first = false
 		} else {
 			fmt.Fprint(out, "\n")
 		}
-		fmt.Fprint(out, "#Label\tParent\tDist.\tType\n")
-		root := sc.Tree()
+		fmt.Fprint(out, "#Label\tParent\tDist.\tType")
+		if ep.depth {
+			fmt.Fprint(out, "\tDepth\tLeaves")
+		}
+		fmt.Fprint(out, "\n")
 		if io {
-			inorder(root, out)
+			inorder(root, out, ep.depth)
 		} else if po {
-			postorder(root, out)
+			postorder(root, out, ep.depth)
 		} else {
-			preorder(root, out)
+			preorder(root, out, ep.depth)
 		}
 		out.Flush()
 	}
 }
-func inorder(v *nwk.Node, w *tabwriter.Writer) {
+func subtree(root *nwk.Node, re *regexp.Regexp) *nwk.Node {
+	var leaves []*nwk.Node
+	leaves = collectLeaves(root, leaves)
+	var lca *nwk.Node
+	for _, leaf := range leaves {
+		if !re.MatchString(leaf.Label) {
+			continue
+		}
+		if lca == nil {
+			lca = leaf
+		} else {
+			lca = lca.LCA(leaf)
+		}
+	}
+	if lca == nil {
+		log.Fatalf("no leaf matches %q", re)
+	}
+	if lca.Parent != nil {
+		lca.Parent.RemoveChild(lca)
+	}
+	return lca
+}
+func collectLeaves(v *nwk.Node, leaves []*nwk.Node) []*nwk.Node {
+	if v.Child == nil {
+		leaves = append(leaves, v)
+	}
+	for c := v.Child; c != nil; c = c.Sib {
+		leaves = collectLeaves(c, leaves)
+	}
+	return leaves
+}
+func prune(root *nwk.Node, re *regexp.Regexp) *nwk.Node {
+	var leaves []*nwk.Node
+	leaves = collectLeaves(root, leaves)
+	for _, leaf := range leaves {
+		if !re.MatchString(leaf.Label) {
+			continue
+		}
+		if leaf == root {
+			log.Fatal("pruned all leaves")
+		}
+		p := leaf.Parent
+		p.RemoveChild(leaf)
+		for p.Child == nil && p.Parent != nil {
+			q := p.Parent
+			q.RemoveChild(p)
+			p = q
+		}
+		if p.Child == nil {
+			log.Fatal("pruned all leaves")
+		}
+		if p.Child.Sib == nil {
+			if p == root {
+				root = p.Child
+				root.Parent = nil
+				root.Length = 0
+			} else {
+				splice(p)
+			}
+		}
+	}
+	return root
+}
+func splice(v *nwk.Node) {
+	p := v.Parent
+	last := v.Child
+	for c := v.Child; c != nil; c = c.Sib {
+		c.Parent = p
+		c.Length += v.Length
+		last = c
+	}
+	last.Sib = v.Sib
+	if p.Child == v {
+		p.Child = v.Child
+	} else {
+		w := p.Child
+		for w.Sib != v {
+			w = w.Sib
+		}
+		w.Sib = v.Child
+	}
+	v.Parent, v.Child, v.Sib = nil, nil, nil
+}
+func collapseShort(root *nwk.Node, min float64) {
+	var nodes []*nwk.Node
+	nodes = collectInternal(root, nodes)
+	for _, v := range nodes {
+		if v.HasLength && v.Length < min {
+			splice(v)
+		}
+	}
+}
+func collectInternal(v *nwk.Node, nodes []*nwk.Node) []*nwk.Node {
+	if v.Child != nil && v.Parent != nil {
+		nodes = append(nodes, v)
+	}
+	for c := v.Child; c != nil; c = c.Sib {
+		nodes = collectInternal(c, nodes)
+	}
+	return nodes
+}
+func collapseWeak(root *nwk.Node, min float64) {
+	var nodes []*nwk.Node
+	nodes = collectInternal(root, nodes)
+	for _, v := range nodes {
+		s, err := strconv.ParseFloat(v.Label, 64)
+		if err == nil && s < min {
+			splice(v)
+		}
+	}
+}
+func ladderize(v *nwk.Node) int {
+	if v.Child == nil {
+		return 1
+	}
+	var children []*nwk.Node
+	var counts []int
+	n := 0
+	for c := v.Child; c != nil; c = c.Sib {
+		children = append(children, c)
+		counts = append(counts, ladderize(c))
+		n += counts[len(counts)-1]
+	}
+	idx := make([]int, len(children))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		return counts[idx[i]] < counts[idx[j]]
+	})
+	v.Child = children[idx[0]]
+	for i := 1; i < len(idx); i++ {
+		children[idx[i-1]].Sib = children[idx[i]]
+	}
+	children[idx[len(idx)-1]].Sib = nil
+	return n
+}
+func rescale(v *nwk.Node, f float64) {
+	v.Length *= f
+	for c := v.Child; c != nil; c = c.Sib {
+		rescale(c, f)
+	}
+}
+func inorder(v *nwk.Node, w *tabwriter.Writer, d bool) {
 	if v == nil {
 		return
 	}
-	inorder(v.Child, w)
+	inorder(v.Child, w, d)
 	typ := "leaf"
 	if v.Parent == nil {
 		typ = "root"
@@ -51,19 +231,42 @@ func inorder(v *nwk.Node, w *tabwriter.Writer) {
 	if v.Parent != nil {
 		p = v.Parent.Label
 	}
-	fmt.Fprintf(w, "%s\t%s\t%.3g\t%s\n",
+	fmt.Fprintf(w, "%s\t%s\t%.3g\t%s",
 		v.Label, p, v.Length, typ)
+	if d {
+		fmt.Fprintf(w, "\t%.3g\t%d", depth(v), numLeaves(v))
+	}
+	fmt.Fprint(w, "\n")
 	if v.Child != nil {
-		inorder(v.Child.Sib, w)
+		for c := v.Child.Sib; c != nil; c = c.Sib {
+			inorder(c, w, d)
+		}
+	}
+}
+func depth(v *nwk.Node) float64 {
+	d := 0.0
+	for v.Parent != nil {
+		d += v.Length
+		v = v.Parent
 	}
+	return d
 }
-func postorder(v *nwk.Node, w *tabwriter.Writer) {
+func numLeaves(v *nwk.Node) int {
+	if v.Child == nil {
+		return 1
+	}
+	n := 0
+	for c := v.Child; c != nil; c = c.Sib {
+		n += numLeaves(c)
+	}
+	return n
+}
+func postorder(v *nwk.Node, w *tabwriter.Writer, d bool) {
 	if v == nil {
 		return
 	}
-	postorder(v.Child, w)
-	if v.Child != nil {
-		postorder(v.Child.Sib, w)
+	for c := v.Child; c != nil; c = c.Sib {
+		postorder(c, w, d)
 	}
 	typ := "leaf"
 	if v.Parent == nil {
@@ -75,10 +278,14 @@ func postorder(v *nwk.Node, w *tabwriter.Writer) {
 	if v.Parent != nil {
 		p = v.Parent.Label
 	}
-	fmt.Fprintf(w, "%s\t%s\t%.3g\t%s\n",
+	fmt.Fprintf(w, "%s\t%s\t%.3g\t%s",
 		v.Label, p, v.Length, typ)
+	if d {
+		fmt.Fprintf(w, "\t%.3g\t%d", depth(v), numLeaves(v))
+	}
+	fmt.Fprint(w, "\n")
 }
-func preorder(v *nwk.Node, w *tabwriter.Writer) {
+func preorder(v *nwk.Node, w *tabwriter.Writer, d bool) {
 	if v == nil {
 		return
 	}
@@ -92,22 +299,38 @@ func preorder(v *nwk.Node, w *tabwriter.Writer) {
 	if v.Parent != nil {
 		p = v.Parent.Label
 	}
-	fmt.Fprintf(w, "%s\t%s\t%.3g\t%s\n",
+	fmt.Fprintf(w, "%s\t%s\t%.3g\t%s",
 		v.Label, p, v.Length, typ)
-	preorder(v.Child, w)
-	if v.Child != nil {
-		preorder(v.Child.Sib, w)
+	if d {
+		fmt.Fprintf(w, "\t%.3g\t%d", depth(v), numLeaves(v))
+	}
+	fmt.Fprint(w, "\n")
+	for c := v.Child; c != nil; c = c.Sib {
+		preorder(c, w, d)
 	}
 }
 func main() {
 	util.PrepLog("travTree")
 	u := "travTree [-h] [option]... [foo.nwk]..."
-	p := "Traverse a tree given in Newick format."
+	p := "Traverse or edit a tree given in Newick format."
 	e := "travTree -i foo.nwk"
 	clio.Usage(u, p, e)
 	var optI = flag.Bool("i", false, "inorder (default preorder)")
 	var optO = flag.Bool("o", false, "postorder (default preorder)")
 	var optV = flag.Bool("v", false, "version")
+	var optD = flag.Bool("d", false, "print depth and number of leaves")
+	var optP = flag.String("p", "", "prune leaves matching "+
+		"regular expression")
+	var optS = flag.String("s", "", "extract subtree rooted on LCA of "+
+		"leaves matching regular expression")
+	var optC = flag.Float64("c", 0, "collapse internal branches "+
+		"shorter than threshold")
+	var optB = flag.Float64("b", 0, "collapse internal branches "+
+		"with support below threshold")
+	var optL = flag.Bool("l", false, "ladderize")
+	var optR = flag.Float64("r", 1, "rescale branch lengths by factor")
+	var optT = flag.Bool("t", false, "print table of edited tree "+
+		"instead of Newick")
 	flag.Parse()
 	if *optV {
 		util.PrintInfo("travTree")
@@ -115,8 +338,32 @@ func main() {
 	if *optI && *optO {
 		log.Fatal("please opt for just one traversal mode")
 	}
+	ep := new(editParams)
+	var err error
+	if *optP != "" {
+		ep.prune, err = regexp.Compile(*optP)
+		if err != nil {
+			log.Fatalf("couldn't compile %q", *optP)
+		}
+	}
+	if *optS != "" {
+		ep.sub, err = regexp.Compile(*optS)
+		if err != nil {
+			log.Fatalf("couldn't compile %q", *optS)
+		}
+	}
+	if *optR <= 0 {
+		log.Fatal("please use a positive scaling factor")
+	}
+	ep.minLen = *optC
+	ep.minSup = *optB
+	ep.scale = *optR
+	ep.ladder = *optL
+	ep.edit = ep.prune != nil || ep.sub != nil || ep.minLen > 0 ||
+		ep.minSup > 0 || ep.scale != 1 || ep.ladder
+	ep.depth = *optD
 	out := tabwriter.NewWriter(os.Stdout, 2, 1, 2, ' ', 0)
 	files := flag.Args()
 	first := true
-	clio.ParseFiles(files, scan, *optI, *optO, out, &first)
+	clio.ParseFiles(files, scan, *optI, *optO, out, &first, ep, *optT)
 }
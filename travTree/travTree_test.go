@@ -17,6 +17,24 @@ func TestTravTree(t *testing.T) {
 	tests = append(tests, test)
 	test = exec.Command("./travTree", "-o", f)
 	tests = append(tests, test)
+	f = "test3.nwk"
+	test = exec.Command("./travTree", "-p", "^[AB]$", f)
+	tests = append(tests, test)
+	test = exec.Command("./travTree", "-s", "^[EG]$", f)
+	tests = append(tests, test)
+	test = exec.Command("./travTree", "-c", "0.2", f)
+	tests = append(tests, test)
+	test = exec.Command("./travTree", "-b", "85", f)
+	tests = append(tests, test)
+	test = exec.Command("./travTree", "-l", f)
+	tests = append(tests, test)
+	test = exec.Command("./travTree", "-r", "2", f)
+	tests = append(tests, test)
+	test = exec.Command("./travTree", "-d", f)
+	tests = append(tests, test)
+	test = exec.Command("./travTree", "-t", "-d", "-l",
+		"-p", "^C$", f)
+	tests = append(tests, test)
 	for i, test := range tests {
 		get, err := test.Output()
 		if err != nil {
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/evolbioinf/biobox/util"
+	"github.com/evolbioinf/clio"
+	"github.com/evolbioinf/nwk"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+type tree struct {
+	taxa   []string
+	splits map[string]float64
+	dist   [][]int
+}
+
+func newTree(root *nwk.Node) *tree {
+	t := new(tree)
+	t.taxa = leaves(root, t.taxa)
+	sort.Strings(t.taxa)
+	t.splits = util.Splits(root)
+	n := len(t.taxa)
+	idx := make(map[string]int)
+	for i, taxon := range t.taxa {
+		idx[taxon] = i
+	}
+	t.dist = make([][]int, n)
+	for i := range t.dist {
+		t.dist[i] = make([]int, n)
+	}
+	depth := make([]int, n)
+	distances(root, 0, idx, depth, t.dist)
+	return t
+}
+func leaves(v *nwk.Node, l []string) []string {
+	if v == nil {
+		return l
+	}
+	if v.Child == nil {
+		l = append(l, v.Label)
+	}
+	l = leaves(v.Child, l)
+	l = leaves(v.Sib, l)
+	return l
+}
+func distances(v *nwk.Node, d int, idx map[string]int,
+	depth []int, dist [][]int) []int {
+	if v.Child == nil {
+		i := idx[v.Label]
+		depth[i] = d
+		return []int{i}
+	}
+	var l []int
+	for c := v.Child; c != nil; c = c.Sib {
+		m := distances(c, d+1, idx, depth, dist)
+		for _, i := range l {
+			for _, j := range m {
+				x := depth[i] + depth[j] - 2*d
+				dist[i][j] = x
+				dist[j][i] = x
+			}
+		}
+		l = append(l, m...)
+	}
+	return l
+}
+func topology(t *tree, w, x, y, z int) byte {
+	d := t.dist
+	s1 := d[w][x] + d[y][z]
+	s2 := d[w][y] + d[x][z]
+	s3 := d[w][z] + d[x][y]
+	if s1 < s2 && s1 < s3 {
+		return 1
+	}
+	if s2 < s1 && s2 < s3 {
+		return 2
+	}
+	if s3 < s1 && s3 < s2 {
+		return 3
+	}
+	return 0
+}
+func scan(r io.Reader, args ...interface{}) {
+	refTrees := args[0].([]*tree)
+	var trees []*tree
+	sc := nwk.NewScanner(r)
+	for sc.Scan() {
+		trees = append(trees, newTree(sc.Tree()))
+	}
+	w := tabwriter.NewWriter(os.Stdout, 1, 1, 1, ' ', 0)
+	if len(refTrees) > 0 {
+		fmt.Fprintf(w, "#Ref\tTree\tRF\tnRF\twRF\tQ\n")
+		for i, t1 := range refTrees {
+			for j, t2 := range trees {
+				printDist(w, i+1, j+1, t1, t2)
+			}
+		}
+	} else {
+		fmt.Fprintf(w, "#T1\tT2\tRF\tnRF\twRF\tQ\n")
+		for i := 0; i < len(trees)-1; i++ {
+			for j := i + 1; j < len(trees); j++ {
+				printDist(w, i+1, j+1, trees[i], trees[j])
+			}
+		}
+	}
+	w.Flush()
+}
+func printDist(w io.Writer, i, j int, t1, t2 *tree) {
+	n := len(t1.taxa)
+	same := n == len(t2.taxa)
+	for k := 0; same && k < n; k++ {
+		if t1.taxa[k] != t2.taxa[k] {
+			same = false
+		}
+	}
+	if !same {
+		log.Fatalf("trees %d and %d have different taxa", i, j)
+	}
+	rf := missing(t1, t2) + missing(t2, t1)
+	nrf := 0.0
+	if n > 3 {
+		nrf = float64(rf) / float64(2*(n-3))
+	}
+	wrf := 0.0
+	for k, l := range t1.splits {
+		wrf += math.Abs(l - t2.splits[k])
+	}
+	for k, l := range t2.splits {
+		if _, ok := t1.splits[k]; !ok {
+			wrf += math.Abs(l)
+		}
+	}
+	qd := 0
+	for w := 0; w < n; w++ {
+		for x := w + 1; x < n; x++ {
+			for y := x + 1; y < n; y++ {
+				for z := y + 1; z < n; z++ {
+					if topology(t1, w, x, y, z) !=
+						topology(t2, w, x, y, z) {
+						qd++
+					}
+				}
+			}
+		}
+	}
+	fmt.Fprintf(w, "%d\t%d\t%d\t%.3g\t%.3g\t%d\n",
+		i, j, rf, nrf, wrf, qd)
+}
+func missing(t1, t2 *tree) int {
+	n := len(t1.taxa)
+	c := 0
+	for k, _ := range t1.splits {
+		m := strings.Count(k, "$") + 1
+		if m < 2 || m > n-2 {
+			continue
+		}
+		if _, ok := t2.splits[k]; !ok {
+			c++
+		}
+	}
+	return c
+}
+func main() {
+	util.PrepLog("treeDist")
+	u := "treeDist [-h] [option]... [trees.nwk]..."
+	p := "Compute distances between phylogenies."
+	e := "treeDist -r true.nwk inferred.nwk"
+	clio.Usage(u, p, e)
+	var optV = flag.Bool("v", false, "version")
+	var optR = flag.String("r", "", "file of reference tree(s) "+
+		"(default: all pairs of input trees)")
+	flag.Parse()
+	if *optV {
+		util.PrintInfo("treeDist")
+	}
+	var refTrees []*tree
+	if *optR != "" {
+		tf, err := os.Open(*optR)
+		if err != nil {
+			log.Fatalf("couldn't open %q", *optR)
+		}
+		defer tf.Close()
+		sc := nwk.NewScanner(tf)
+		for sc.Scan() {
+			refTrees = append(refTrees, newTree(sc.Tree()))
+		}
+	}
+	files := flag.Args()
+	clio.ParseFiles(files, scan, refTrees)
+}
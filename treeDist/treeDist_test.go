@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"testing"
+)
+
+func TestTreeDist(t *testing.T) {
+	var tests []*exec.Cmd
+	test := exec.Command("./treeDist", "trees.nwk")
+	tests = append(tests, test)
+	test = exec.Command("./treeDist", "-r", "ref.nwk", "trees.nwk")
+	tests = append(tests, test)
+	for i, test := range tests {
+		get, err := test.Output()
+		if err != nil {
+			t.Errorf("couldn't run %q", test)
+		}
+		f := "r" + strconv.Itoa(i+1) + ".txt"
+		want, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Errorf("couldn't open %q", f)
+		}
+		if !bytes.Equal(get, want) {
+			t.Errorf("get:\n%s\nwant:\n%s", get, want)
+		}
+	}
+}
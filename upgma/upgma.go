@@ -8,87 +8,68 @@ import (
 	"github.com/evolbioinf/dist"
 	"github.com/evolbioinf/nwk"
 	"io"
+	"log"
+	"os"
 )
 
 func scan(r io.Reader, args ...interface{}) {
 	printMat := args[0].(bool)
+	wpgma := args[1].(bool)
+	refTrees := args[2].([]*nwk.Node)
+	clades := make(map[string]int)
+	nt := 0
 	sc := dist.NewScanner(r)
 	for sc.Scan() {
 		dm := sc.DistanceMatrix()
 		dm.MakeSymmetrical()
-		n := len(dm.Names)
 		var root *nwk.Node
-		t := make([]*nwk.Node, n)
-		for i := 0; i < n; i++ {
-			t[i] = nwk.NewNode()
-			t[i].Label = dm.Names[i]
-		}
-		for i := n; i > 1; i-- {
-			if printMat {
-				fmt.Printf("%s", dm)
-			}
-			md, mj, mk := dm.Min()
-			c1 := t[mj]
-			c2 := t[mk]
-			root = nwk.NewNode()
-			l := fmt.Sprintf("(%s,%s)", c1.Label, c2.Label)
-			root.Label = l
-			root.Length = md / 2
-			root.AddChild(c1)
-			root.AddChild(c2)
-			data := make([]float64, i-2)
-			k := 0
-			for j := 0; j < i; j++ {
-				if j == mj || j == mk {
-					continue
-				}
-				data[k] = (dm.Matrix[j][mj] + dm.Matrix[j][mk]) / 2.0
-				k++
-			}
-			dm.DeletePair(mj, mk)
-			dm.Append(root.Label, data)
-			j := 0
-			for k := 0; k < i; k++ {
-				if k == mj || k == mk {
-					continue
-				}
-				t[j] = t[k]
-				j++
+		var pm func(*dist.DistMat)
+		if printMat {
+			pm = func(d *dist.DistMat) {
+				fmt.Printf("%s", d)
 			}
-			t = t[:j]
-			t = append(t, root)
 		}
-		branchLengths(root)
-		fmt.Println(root)
-	}
-}
-func branchLengths(v *nwk.Node) {
-	if v == nil {
-		return
-	}
-	branchLengths(v.Child)
-	branchLengths(v.Sib)
-	if v.Child != nil {
-		v.Label = ""
+		root = util.Upgma(dm, wpgma, pm)
+		if len(refTrees) == 0 {
+			fmt.Println(root)
+		} else {
+			util.CountClades(root, clades, false)
+			nt++
+		}
 	}
-	if v.Parent != nil {
-		v.Length = v.Parent.Length - v.Length
-		v.HasLength = true
+	for _, ref := range refTrees {
+		util.AnnotateClades(ref, clades, nt, false)
+		fmt.Println(ref)
 	}
 }
 func main() {
 	util.PrepLog("upgma")
 	u := "upgma [-h] [option]... [foo.dist]..."
-	p := "Cluster a distance matrix into a tree using UPGMA."
+	p := "Cluster a distance matrix into a tree using UPGMA or WPGMA."
 	e := "upgma foo.dist"
 	clio.Usage(u, p, e)
 	var optV = flag.Bool("v", false, "version")
 	var optM = flag.Bool("m", false, "print intermediate "+
 		"matrices")
+	var optR = flag.String("r", "", "file of reference tree(s) "+
+		"to annotate with bootstrap support")
+	var optW = flag.Bool("w", false, "WPGMA instead of UPGMA")
 	flag.Parse()
 	if *optV {
 		util.PrintInfo("upgma")
 	}
+	var refTrees []*nwk.Node
+	if *optR != "" {
+		tf, err := os.Open(*optR)
+		if err != nil {
+			log.Fatalf("couldn't open %q", *optR)
+		}
+		defer tf.Close()
+		sc := nwk.NewScanner(tf)
+		for sc.Scan() {
+			refTrees = append(refTrees, sc.Tree())
+		}
+	}
 	files := flag.Args()
-	clio.ParseFiles(files, scan, *optM)
+	clio.ParseFiles(files, scan, *optM, *optW, refTrees)
 }
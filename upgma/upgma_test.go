@@ -8,16 +8,25 @@ import (
 )
 
 func TestUpgma(t *testing.T) {
-	cmd := exec.Command("./upgma", "-m", "test.phy")
-	get, err := cmd.Output()
-	if err != nil {
-		t.Errorf("can't run %q", cmd)
-	}
-	want, err := ioutil.ReadFile("r.txt")
-	if err != nil {
-		t.Errorf("can't open r.txt")
-	}
-	if !bytes.Equal(get, want) {
-		t.Errorf("get:\n%s\nwant:\n%s\n", get, want)
+	var tests []*exec.Cmd
+	cmd := exec.Command("./upgma", "-w", "-m", "test.phy")
+	tests = append(tests, cmd)
+	cmd = exec.Command("./upgma", "-r", "ref.nwk", "boot.phy")
+	tests = append(tests, cmd)
+	cmd = exec.Command("./upgma", "-m", "test.phy")
+	tests = append(tests, cmd)
+	results := []string{"r.txt", "r2.txt", "r3.txt"}
+	for i, cmd := range tests {
+		get, err := cmd.Output()
+		if err != nil {
+			t.Errorf("can't run %q", cmd)
+		}
+		want, err := ioutil.ReadFile(results[i])
+		if err != nil {
+			t.Errorf("can't open %q", results[i])
+		}
+		if !bytes.Equal(get, want) {
+			t.Errorf("get:\n%s\nwant:\n%s\n", get, want)
+		}
 	}
 }
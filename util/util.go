@@ -12,12 +12,17 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/evolbioinf/clio"
+	"github.com/evolbioinf/dist"
 	"github.com/evolbioinf/fasta"
+	"github.com/evolbioinf/nwk"
+	"html"
 	"io"
 	"log"
 	"math"
+	"math/rand"
 	"os"
 	"os/exec"
+	"sort"
 	"strconv"
 	"strings"
 	"text/tabwriter"
@@ -28,6 +33,8 @@ const (
 	email   = "haubold@evolbio.mpg.de"
 	license = "Gnu General Public License, " +
 		"https://www.gnu.org/licenses/gpl.html"
+	euler  = 0.5772156649015329
+	svgPad = 10.0
 )
 
 // The structure Alignment holds the alignment of two sequences.
@@ -49,8 +56,111 @@ type TransitionTab struct {
 	ts        [][]bool
 }
 
+// A GeneticCode maps codons to amino acids and marks the codons that may serve as translation start.
+type GeneticCode struct {
+	id     int
+	name   string
+	aa     map[string]byte
+	starts map[string]bool
+}
+type ncbiCode struct {
+	id               int
+	name, aa, starts string
+}
+
+// An SVG is a drawing in scalable vector graphics. It is drawn in user coordinates, which are mapped onto a canvas of given width and height in pixels. This allows the plot programs to draw without gnuplot.
+type SVG struct {
+	width, height          float64
+	xMin, xMax, yMin, yMax float64
+	elements               []string
+}
+
 var version string
 var date string
+var ncbiCodes = []ncbiCode{
+	{1, "Standard",
+		"FFLLSSSSYY**CC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG",
+		"---M------**--*----M---------------M----------------------------"},
+	{2, "Vertebrate Mitochondrial",
+		"FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIMMTTTTNNKKSS**VVVVAAAADDEEGGGG",
+		"----------**--------------------MMMM----------**---M------------"},
+	{3, "Yeast Mitochondrial",
+		"FFLLSSSSYY**CCWWTTTTPPPPHHQQRRRRIIMMTTTTNNKKSSRRVVVVAAAADDEEGGGG",
+		"----------**----------------------MM---------------M------------"},
+	{4, "Mold, Protozoan, and Coelenterate Mitochondrial " +
+		"and Mycoplasma/Spiroplasma",
+		"FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG",
+		"--MM------**-------M------------MMMM---------------M------------"},
+	{5, "Invertebrate Mitochondrial",
+		"FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIMMTTTTNNKKSSSSVVVVAAAADDEEGGGG",
+		"---M------**--------------------MMMM---------------M------------"},
+	{6, "Ciliate, Dasycladacean and Hexamita Nuclear",
+		"FFLLSSSSYYQQCC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG",
+		"--------------*--------------------M----------------------------"},
+	{9, "Echinoderm and Flatworm Mitochondrial",
+		"FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIIMTTTTNNNKSSSSVVVVAAAADDEEGGGG",
+		"----------**-----------------------M---------------M------------"},
+	{10, "Euplotid Nuclear",
+		"FFLLSSSSYY**CCCWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG",
+		"----------**-----------------------M----------------------------"},
+	{11, "Bacterial, Archaeal and Plant Plastid",
+		"FFLLSSSSYY**CC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG",
+		"---M------**--*----M------------MMMM---------------M------------"},
+	{12, "Alternative Yeast Nuclear",
+		"FFLLSSSSYY**CC*WLLLSPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG",
+		"----------**--*----M---------------M----------------------------"},
+	{13, "Ascidian Mitochondrial",
+		"FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIMMTTTTNNKKSSGGVVVVAAAADDEEGGGG",
+		"---M------**----------------------MM---------------M------------"},
+	{14, "Alternative Flatworm Mitochondrial",
+		"FFLLSSSSYYY*CCWWLLLLPPPPHHQQRRRRIIIMTTTTNNNKSSSSVVVVAAAADDEEGGGG",
+		"-----------*-----------------------M----------------------------"},
+	{16, "Chlorophycean Mitochondrial",
+		"FFLLSSSSYY*LCC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG",
+		"----------*---*--------------------M----------------------------"},
+	{21, "Trematode Mitochondrial",
+		"FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIMMTTTTNNNKSSSSVVVVAAAADDEEGGGG",
+		"----------**-----------------------M---------------M------------"},
+	{22, "Scenedesmus obliquus Mitochondrial",
+		"FFLLSS*SYY*LCC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG",
+		"------*---*---*--------------------M----------------------------"},
+	{23, "Thraustochytrium Mitochondrial",
+		"FF*LSSSSYY**CC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG",
+		"--*-------**--*-----------------M--M---------------M------------"},
+	{24, "Rhabdopleuridae Mitochondrial",
+		"FFLLSSSSYY**CCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSSKVVVVAAAADDEEGGGG",
+		"---M------**-------M---------------M---------------M------------"},
+	{25, "Candidate Division SR1 and Gracilibacteria",
+		"FFLLSSSSYY**CCGWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG",
+		"---M------**-----------------------M---------------M------------"},
+	{26, "Pachysolen tannophilus Nuclear",
+		"FFLLSSSSYY**CC*WLLLAPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG",
+		"----------**--*----M---------------M----------------------------"},
+	{27, "Karyorelict Nuclear",
+		"FFLLSSSSYYQQCCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG",
+		"--------------*--------------------M----------------------------"},
+	{28, "Condylostoma Nuclear",
+		"FFLLSSSSYYQQCCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG",
+		"----------**--*--------------------M----------------------------"},
+	{29, "Mesodinium Nuclear",
+		"FFLLSSSSYYYYCC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG",
+		"--------------*--------------------M----------------------------"},
+	{30, "Peritrich Nuclear",
+		"FFLLSSSSYYEECC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG",
+		"--------------*--------------------M----------------------------"},
+	{31, "Blastocrithidia Nuclear",
+		"FFLLSSSSYYEECCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG",
+		"----------**-----------------------M----------------------------"},
+	{33, "Cephalodiscidae Mitochondrial",
+		"FFLLSSSSYYY*CCWWLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSSKVVVVAAAADDEEGGGG",
+		"---M-------*-------M---------------M---------------M------------"},
+}
+var iupac = map[byte]string{
+	'A': "A", 'C': "C", 'G': "G", 'T': "T", 'U': "T",
+	'R': "AG", 'Y': "CT", 'S': "CG", 'W': "AT",
+	'K': "GT", 'M': "AC", 'B': "CGT", 'D': "AGT",
+	'H': "ACT", 'V': "ACG", 'N': "ACGT",
+}
 
 // SetLineLength sets the lengths of data lines in the printout of an alignment. If the length passed is less than one, no change is made.
 func (a *Alignment) SetLineLength(l int) {
@@ -153,6 +263,113 @@ func (t TransitionTab) IsTransition(a, b byte) bool {
 	return t.ts[a][b]
 }
 
+// Id returns the NCBI identifier of a genetic code.
+func (g *GeneticCode) Id() int {
+	return g.id
+}
+
+// Name returns the name of a genetic code.
+func (g *GeneticCode) Name() string {
+	return g.name
+}
+
+// Translate takes as argument a codon and returns the amino acid it encodes. Codons may be in lower case and may contain IUPAC ambiguity codes. An ambiguous codon is translated if all its expansions encode the same amino acid, otherwise it is translated as X.
+func (g *GeneticCode) Translate(codon []byte) byte {
+	if a, ok := g.aa[string(codon)]; ok {
+		return a
+	}
+	codons := expandCodon(codon)
+	if len(codons) == 0 {
+		return 'X'
+	}
+	a := g.aa[codons[0]]
+	for _, c := range codons[1:] {
+		if g.aa[c] != a {
+			return 'X'
+		}
+	}
+	return a
+}
+
+// IsStart takes as argument a codon and returns true if it may serve as start codon. An ambiguous codon is a start codon if all its expansions are.
+func (g *GeneticCode) IsStart(codon []byte) bool {
+	codons := expandCodon(codon)
+	if len(codons) == 0 {
+		return false
+	}
+	for _, c := range codons {
+		if !g.starts[c] {
+			return false
+		}
+	}
+	return true
+}
+func (s *SVG) pixel(x, y float64) (float64, float64) {
+	w := s.width - 2*svgPad
+	h := s.height - 2*svgPad
+	px := svgPad + (x-s.xMin)/(s.xMax-s.xMin)*w
+	py := s.height - svgPad - (y-s.yMin)/(s.yMax-s.yMin)*h
+	return px, py
+}
+
+// Line draws a line from (x_1,y_1) to (x_2,y_2) in a given color and width in pixels. The empty color is black.
+func (s *SVG) Line(x1, y1, x2, y2 float64, color string,
+	width float64) {
+	if color == "" {
+		color = "black"
+	}
+	px1, py1 := s.pixel(x1, y1)
+	px2, py2 := s.pixel(x2, y2)
+	e := fmt.Sprintf("<line x1=\"%.2f\" y1=\"%.2f\" "+
+		"x2=\"%.2f\" y2=\"%.2f\" stroke=\"%s\" "+
+		"stroke-width=\"%.3g\" stroke-linecap=\"round\"/>",
+		px1, py1, px2, py2, html.EscapeString(color), width)
+	s.elements = append(s.elements, e)
+}
+
+// Text writes a text at a point. The text is anchored at the point by its left end (l), its center (c), or its right end (r), and rotated counterclockwise by an angle in degrees. It can also be offset horizontally and vertically by a number of characters.
+func (s *SVG) Text(x, y float64, text, anchor string,
+	angle, dx, dy float64) {
+	px, py := s.pixel(x, y)
+	a := "start"
+	if anchor == "c" {
+		a = "middle"
+	} else if anchor == "r" {
+		a = "end"
+	}
+	e := fmt.Sprintf("<text x=\"%.2f\" y=\"%.2f\" "+
+		"text-anchor=\"%s\" dominant-baseline=\"central\"",
+		px, py, a)
+	if dx != 0 || dy != 0 {
+		e += fmt.Sprintf(" dx=\"%.3gem\" dy=\"%.3gem\"",
+			0.6*dx, -dy)
+	}
+	if angle != 0 {
+		e += fmt.Sprintf(" transform=\"rotate(%.3g %.2f %.2f)\"",
+			-angle, px, py)
+	}
+	e += fmt.Sprintf(" xml:space=\"preserve\">%s</text>",
+		html.EscapeString(text))
+	s.elements = append(s.elements, e)
+}
+
+// String returns the SVG document.
+func (s *SVG) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(&b, "<svg xmlns=\"http://www.w3.org/2000/svg\" "+
+		"width=\"%g\" height=\"%g\" viewBox=\"0 0 %g %g\" "+
+		"font-family=\"sans-serif\" font-size=\"12\">\n",
+		s.width, s.height, s.width, s.height)
+	fmt.Fprintf(&b, "<rect width=\"100%%\" height=\"100%%\" "+
+		"fill=\"white\"/>\n")
+	for _, e := range s.elements {
+		fmt.Fprintf(&b, "%s\n", e)
+	}
+	fmt.Fprintf(&b, "</svg>\n")
+	return b.String()
+}
+
 // NewAlignment takes as arguments two aligned sequences, the score matrix used in computing the alignment, lengths of the two sequences, start positions in the two sequences, and the score. The start positions are zero-based.
 func NewAlignment(seq1, seq2 *fasta.Sequence, sm *ScoreMatrix,
 	l1, l2, s1, s2 int, score float64) *Alignment {
@@ -375,3 +592,470 @@ func CheckWindow(win string) {
 		CheckGnuplot(err)
 	}
 }
+
+// NewGeneticCode takes as argument the NCBI identifier of a genetic code and returns the corresponding GeneticCode. If the identifier is unknown, it exits with a message.
+func NewGeneticCode(id int) *GeneticCode {
+	var nc *ncbiCode
+	for i, c := range ncbiCodes {
+		if c.id == id {
+			nc = &ncbiCodes[i]
+			break
+		}
+	}
+	if nc == nil {
+		log.Fatalf("unknown genetic code %d", id)
+	}
+	gc := new(GeneticCode)
+	gc.id = nc.id
+	gc.name = nc.name
+	gc.aa = make(map[string]byte)
+	gc.starts = make(map[string]bool)
+	dna := "TCAG"
+	codon := make([]byte, 3)
+	n := 0
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			for k := 0; k < 4; k++ {
+				codon[0] = dna[i]
+				codon[1] = dna[j]
+				codon[2] = dna[k]
+				gc.aa[string(codon)] = nc.aa[n]
+				if nc.starts[n] == 'M' {
+					gc.starts[string(codon)] = true
+				}
+				n++
+			}
+		}
+	}
+	return gc
+}
+
+// GeneticCodes returns the identifiers and names of the available genetic codes as a string, one code per line.
+func GeneticCodes() string {
+	s := ""
+	for _, c := range ncbiCodes {
+		s += fmt.Sprintf("%d\t%s\n", c.id, c.name)
+	}
+	return s
+}
+func expandCodon(codon []byte) []string {
+	codons := []string{""}
+	if len(codon) != 3 {
+		return codons[:0]
+	}
+	for _, c := range bytes.ToUpper(codon) {
+		nucs, ok := iupac[c]
+		if !ok {
+			return codons[:0]
+		}
+		var ext []string
+		for _, p := range codons {
+			for _, n := range nucs {
+				ext = append(ext, p+string(n))
+			}
+		}
+		codons = ext
+	}
+	return codons
+}
+
+// CountClades takes as arguments the root of a tree, a map of clade counts, and whether the tree is unrooted. It increments the count of each clade defined by an internal node except the root. In unrooted trees, each clade is represented by the side of its split that doesn't contain the alphabetically first leaf.
+func CountClades(v *nwk.Node, c map[string]int, unrooted bool) {
+	taxa := leafLabels(v)
+	clades := make(map[string]bool)
+	collectClades(v, clades, taxa, unrooted)
+	for k, _ := range clades {
+		c[k]++
+	}
+}
+func leafLabels(v *nwk.Node) []string {
+	var labels []string
+	var collect func(*nwk.Node)
+	collect = func(w *nwk.Node) {
+		if w == nil {
+			return
+		}
+		if w.Child == nil {
+			labels = append(labels, w.Label)
+		}
+		collect(w.Child)
+		collect(w.Sib)
+	}
+	if v.Child == nil {
+		return []string{v.Label}
+	}
+	collect(v.Child)
+	sort.Strings(labels)
+	return labels
+}
+func collectClades(v *nwk.Node, clades map[string]bool,
+	taxa []string, unrooted bool) {
+	if v == nil {
+		return
+	}
+	if v.Parent != nil && v.Child != nil {
+		k := cladeKey(v, taxa, unrooted)
+		if k != "" {
+			clades[k] = true
+		}
+	}
+	collectClades(v.Child, clades, taxa, unrooted)
+	collectClades(v.Sib, clades, taxa, unrooted)
+}
+func cladeKey(v *nwk.Node, taxa []string, unrooted bool) string {
+	if !unrooted {
+		return v.Key("$")
+	}
+	leaves := leafLabels(v)
+	if len(leaves) < 2 || len(leaves) > len(taxa)-2 {
+		return ""
+	}
+	return splitKey(leaves, taxa)
+}
+func splitKey(leaves, taxa []string) string {
+	if leaves[0] == taxa[0] {
+		var comp []string
+		j := 0
+		for _, t := range taxa {
+			if j < len(leaves) && leaves[j] == t {
+				j++
+			} else {
+				comp = append(comp, t)
+			}
+		}
+		leaves = comp
+	}
+	return strings.Join(leaves, "$")
+}
+
+// AnnotateClades takes as arguments the root of a tree, a map of clade counts, the number of trees counted, and whether the trees are unrooted. It labels each internal node except the root with the percentage of trees containing its clade, rounded to the nearest integer.
+func AnnotateClades(v *nwk.Node, c map[string]int, n int,
+	unrooted bool) {
+	taxa := leafLabels(v)
+	annotateClades(v, c, n, taxa, unrooted)
+}
+func annotateClades(v *nwk.Node, c map[string]int, n int,
+	taxa []string, unrooted bool) {
+	if v == nil {
+		return
+	}
+	if v.Parent != nil && v.Child != nil {
+		k := cladeKey(v, taxa, unrooted)
+		p := float64(c[k]) / float64(n) * 100.0
+		p = math.Round(p)
+		v.Label = strconv.Itoa(int(p))
+	}
+	annotateClades(v.Child, c, n, taxa, unrooted)
+	annotateClades(v.Sib, c, n, taxa, unrooted)
+}
+
+// Splits takes as argument the root of an unrooted tree and returns its splits mapped to their branch lengths. Each split is keyed like an unrooted clade in CountClades, except that trivial splits, which separate a single leaf, are included.
+func Splits(v *nwk.Node) map[string]float64 {
+	taxa := leafLabels(v)
+	splits := make(map[string]float64)
+	var visit func(*nwk.Node)
+	visit = func(w *nwk.Node) {
+		if w == nil {
+			return
+		}
+		if w.Parent != nil {
+			k := splitKey(leafLabels(w), taxa)
+			splits[k] += w.Length
+		}
+		visit(w.Child)
+		visit(w.Sib)
+	}
+	visit(v)
+	return splits
+}
+
+// Upgma takes as arguments a distance matrix, whether to give the two clusters merged equal weight as in WPGMA, and a function for printing the intermediate matrices, which may be nil. It returns the root of the rooted tree. The distance matrix is consumed.
+func Upgma(dm *dist.DistMat, wpgma bool,
+	printMat func(*dist.DistMat)) *nwk.Node {
+	n := len(dm.Names)
+	t := make([]*nwk.Node, n)
+	sizes := make([]int, n)
+	for i := 0; i < n; i++ {
+		t[i] = nwk.NewNode()
+		t[i].Label = dm.Names[i]
+		sizes[i] = 1
+	}
+	for i := n; i > 1; i-- {
+		if printMat != nil {
+			printMat(dm)
+		}
+		md, mj, mk := dm.Min()
+		v := nwk.NewNode()
+		v.Label = fmt.Sprintf("(%s,%s)", t[mj].Label, t[mk].Label)
+		v.Length = md / 2.0
+		v.AddChild(t[mj])
+		v.AddChild(t[mk])
+		w1 := float64(sizes[mj])
+		w2 := float64(sizes[mk])
+		if wpgma {
+			w1 = 1.0
+			w2 = 1.0
+		}
+		data := make([]float64, 0, i-2)
+		for j := 0; j < i; j++ {
+			if j == mj || j == mk {
+				continue
+			}
+			data = append(data, (w1*dm.Matrix[j][mj]+
+				w2*dm.Matrix[j][mk])/(w1+w2))
+		}
+		dm.DeletePair(mj, mk)
+		dm.Append(v.Label, data)
+		s := sizes[mj] + sizes[mk]
+		k := 0
+		for j := 0; j < i; j++ {
+			if j == mj || j == mk {
+				continue
+			}
+			t[k] = t[j]
+			sizes[k] = sizes[j]
+			k++
+		}
+		t = append(t[:k], v)
+		sizes = append(sizes[:k], s)
+	}
+	heightsToLengths(t[0])
+	return t[0]
+}
+func heightsToLengths(v *nwk.Node) {
+	if v == nil {
+		return
+	}
+	heightsToLengths(v.Child)
+	heightsToLengths(v.Sib)
+	if v.Child != nil {
+		v.Label = ""
+	}
+	if v.Parent != nil {
+		v.Length = v.Parent.Length - v.Length
+		v.HasLength = true
+	}
+}
+
+// Nj takes as arguments a distance matrix, whether to use BIONJ, and a function for printing the intermediate distance matrices, supplementary matrices, and row sums, which may be nil. It returns the root of the unrooted tree, whose branch lengths may be negative. The distance matrix is consumed.
+func Nj(dm *dist.DistMat, bionj bool,
+	printMat func(dm, sm *dist.DistMat, r []float64)) *nwk.Node {
+	n := len(dm.Names)
+	if n < 2 {
+		log.Fatal("util.Nj: Error, need at least two taxa.\n")
+	}
+	t := make([]*nwk.Node, n)
+	for i := 0; i < n; i++ {
+		t[i] = nwk.NewNode()
+		t[i].Label = dm.Names[i]
+	}
+	var vm *dist.DistMat
+	if bionj {
+		vm = dist.NewDistMat(n)
+		copy(vm.Names, dm.Names)
+		for i := 0; i < n; i++ {
+			copy(vm.Matrix[i], dm.Matrix[i])
+		}
+	}
+	r := rowSums(dm)
+	sm := supplementaryMatrix(dm, r)
+	for i := n; i > 3; i-- {
+		if printMat != nil {
+			printMat(dm, sm, r)
+		}
+		_, mj, mk := sm.Min()
+		c1 := t[mj]
+		c2 := t[mk]
+		v := nwk.NewNode()
+		v.Label = fmt.Sprintf("(%s,%s)", c1.Label, c2.Label)
+		x := float64(i-2) * dm.Matrix[mj][mk]
+		denom := float64(2 * (i - 2))
+		c1.Length = (x + r[mj] - r[mk]) / denom
+		c2.Length = (x + r[mk] - r[mj]) / denom
+		c1.HasLength = true
+		c2.HasLength = true
+		v.AddChild(c1)
+		v.AddChild(c2)
+		data := make([]float64, i-2)
+		k := 0
+		if bionj {
+			lambda := bionjLambda(vm, mj, mk)
+			vdata := make([]float64, i-2)
+			for j := 0; j < i; j++ {
+				if j == mj || j == mk {
+					continue
+				}
+				data[k] = lambda*(dm.Matrix[j][mj]-c1.Length) +
+					(1.0-lambda)*(dm.Matrix[j][mk]-c2.Length)
+				vdata[k] = lambda*vm.Matrix[j][mj] +
+					(1.0-lambda)*vm.Matrix[j][mk] -
+					lambda*(1.0-lambda)*vm.Matrix[mj][mk]
+				k++
+			}
+			vm.DeletePair(mj, mk)
+			vm.Append(v.Label, vdata)
+		} else {
+			for j := 0; j < i; j++ {
+				if j == mj || j == mk {
+					continue
+				}
+				data[k] = (dm.Matrix[j][mj] +
+					dm.Matrix[j][mk] - dm.Matrix[mj][mk]) / 2.0
+				k++
+			}
+		}
+		dm.DeletePair(mj, mk)
+		dm.Append(v.Label, data)
+		k = 0
+		for j := 0; j < i; j++ {
+			if j == mj || j == mk {
+				continue
+			}
+			t[k] = t[j]
+			k++
+		}
+		t = append(t[:k], v)
+		r = rowSums(dm)
+		sm = supplementaryMatrix(dm, r)
+	}
+	if printMat != nil {
+		printMat(dm, sm, r)
+	}
+	root := nwk.NewNode()
+	d := dm.Matrix
+	if n == 2 {
+		t[0].Length = d[0][1] / 2.0
+		t[1].Length = d[0][1] / 2.0
+	} else {
+		t[0].Length = (d[0][1] + d[0][2] - d[1][2]) / 2.0
+		t[1].Length = (d[1][0] + d[1][2] - d[0][2]) / 2.0
+		t[2].Length = (d[2][0] + d[2][1] - d[0][1]) / 2.0
+	}
+	for _, v := range t {
+		v.HasLength = true
+		root.AddChild(v)
+	}
+	resetLabels(root)
+	return root
+}
+func rowSums(dm *dist.DistMat) []float64 {
+	n := len(dm.Names)
+	r := make([]float64, n)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			r[i] += dm.Matrix[i][j]
+		}
+	}
+	return r
+}
+func supplementaryMatrix(dm *dist.DistMat, r []float64) *dist.DistMat {
+	n := len(dm.Names)
+	sm := dist.NewDistMat(n)
+	for i := 0; i < n-1; i++ {
+		for j := i + 1; j < n; j++ {
+			sm.Matrix[i][j] = dm.Matrix[i][j] -
+				(r[i]+r[j])/float64(n-2)
+			sm.Matrix[j][i] = sm.Matrix[i][j]
+		}
+	}
+	return sm
+}
+func bionjLambda(vm *dist.DistMat, a, b int) float64 {
+	vab := vm.Matrix[a][b]
+	if vab == 0 {
+		return 0.5
+	}
+	n := len(vm.Names)
+	s := 0.0
+	for k := 0; k < n; k++ {
+		if k == a || k == b {
+			continue
+		}
+		s += vm.Matrix[b][k] - vm.Matrix[a][k]
+	}
+	l := 0.5 + s/(2.0*float64(n-2)*vab)
+	if l < 0 {
+		l = 0
+	} else if l > 1 {
+		l = 1
+	}
+	return l
+}
+func resetLabels(v *nwk.Node) {
+	if v == nil {
+		return
+	}
+	resetLabels(v.Child)
+	resetLabels(v.Sib)
+	if v.Child != nil {
+		v.Label = ""
+	}
+}
+
+// HarmonicNumber takes as arguments n and m and returns the generalized harmonic number, the sum of 1/i^m for i from 1 to n.
+func HarmonicNumber(n int, m float64) float64 {
+	h := 0.0
+	for i := 1; i <= n; i++ {
+		h += 1 / math.Pow(float64(i), m)
+	}
+	return h
+}
+
+// ShuffledScores takes as arguments a query, a subject, the number of shuffles, a random number generator, and a function for scoring the query against a subject. It returns the scores of the query against that many shuffled versions of the subject.
+func ShuffledScores(q, s *fasta.Sequence, n int, r *rand.Rand,
+	score func(q, s *fasta.Sequence) float64) []float64 {
+	scores := make([]float64, n)
+	sh := fasta.NewSequence(s.Header(), s.Data())
+	for i := 0; i < n; i++ {
+		sh.Shuffle(r)
+		scores[i] = score(q, sh)
+	}
+	return scores
+}
+
+// KarlinAltschul takes as arguments the scores of optimal local alignments between random sequences and the lengths of these sequences. It fits an extreme value distribution to the scores and returns the Karlin-Altschul parameters lambda and K. The estimates are noisy for small samples; use at least 100 scores.
+func KarlinAltschul(scores []float64, m, n int) (lambda, k float64) {
+	mean, v := MeanVar(scores)
+	if v == 0 || math.IsNaN(v) {
+		log.Fatal("util.KarlinAltschul: Error, scores constant.\n")
+	}
+	lambda = math.Pi / math.Sqrt(6.0*v)
+	u := mean - euler/lambda
+	k = math.Exp(lambda*u) / float64(m) / float64(n)
+	return lambda, k
+}
+
+// EValue takes as arguments a score, the Karlin-Altschul parameters lambda and K, and the lengths of the sequences aligned. It returns the expected number of local alignments with at least that score.
+func EValue(s, lambda, k float64, m, n int) float64 {
+	return k * float64(m) * float64(n) * math.Exp(-lambda*s)
+}
+
+// BitScore takes as arguments a score and the Karlin-Altschul parameters lambda and K, and returns the bit score.
+func BitScore(s, lambda, k float64) float64 {
+	return (lambda*s - math.Log(k)) / math.Ln2
+}
+
+// ZScore takes as arguments a score and a sample of scores, and returns the distance of the score from the sample mean in units of the sample's standard deviation.
+func ZScore(s float64, scores []float64) float64 {
+	m, v := MeanVar(scores)
+	if v == 0 || math.IsNaN(v) {
+		log.Fatal("util.ZScore: Error, scores constant.\n")
+	}
+	return (s - m) / math.Sqrt(v)
+}
+
+// NewSVG takes as arguments the width and height of the canvas in pixels and the minima and maxima of the x and y coordinates, and returns a new SVG.
+func NewSVG(w, h, xMin, xMax, yMin, yMax float64) *SVG {
+	s := new(SVG)
+	s.width = w
+	s.height = h
+	if xMax <= xMin {
+		xMax = xMin + 1
+	}
+	if yMax <= yMin {
+		yMax = yMin + 1
+	}
+	s.xMin, s.xMax = xMin, xMax
+	s.yMin, s.yMax = yMin, yMax
+	return s
+}
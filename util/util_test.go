@@ -3,9 +3,14 @@ package util
 import (
 	"bytes"
 	"fmt"
+	"github.com/evolbioinf/dist"
 	"github.com/evolbioinf/fasta"
+	"github.com/evolbioinf/nwk"
 	"io/ioutil"
+	"math"
+	"math/rand"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -108,4 +113,132 @@ func TestUtil(t *testing.T) {
 	if err != nil {
 		t.Errorf("couldn't remove %q\n", fn)
 	}
+	codons := []string{"ATG", "TGA", "AGA", "TTT"}
+	ids := []int{1, 2, 11}
+	aas := []string{"M*RF", "MW*F", "M*RF"}
+	for i, id := range ids {
+		gc := NewGeneticCode(id)
+		for j, codon := range codons {
+			g := gc.Translate([]byte(codon))
+			if g != aas[i][j] {
+				t.Errorf("code %d, %s: want %c, get %c\n",
+					id, codon, aas[i][j], g)
+			}
+		}
+	}
+	if !NewGeneticCode(11).IsStart([]byte("GTG")) {
+		t.Errorf("GTG should be a start in code 11\n")
+	}
+	if NewGeneticCode(1).IsStart([]byte("GTG")) {
+		t.Errorf("GTG shouldn't be a start in code 1\n")
+	}
+	gc := NewGeneticCode(1)
+	codons = []string{"atg", "GCN", "TAR", "YTA", "TTN", "NNN", "AT", "A-G"}
+	aa := "MA*LXXXX"
+	for i, codon := range codons {
+		g := gc.Translate([]byte(codon))
+		if g != aa[i] {
+			t.Errorf("%s: want %c, get %c\n", codon, aa[i], g)
+		}
+	}
+	sc := nwk.NewScanner(strings.NewReader("((A,B),(C,D));" +
+		"(A,B,(C,D));"))
+	var trees []*nwk.Node
+	for sc.Scan() {
+		trees = append(trees, sc.Tree())
+	}
+	rooted := make(map[string]int)
+	unrooted := make(map[string]int)
+	for _, tree := range trees {
+		CountClades(tree, rooted, false)
+		CountClades(tree, unrooted, true)
+	}
+	if len(rooted) != 2 || rooted["A$B"] != 1 || rooted["C$D"] != 2 {
+		t.Errorf("rooted clades: %v\n", rooted)
+	}
+	if len(unrooted) != 1 || unrooted["C$D"] != 2 {
+		t.Errorf("unrooted clades: %v\n", unrooted)
+	}
+	sp := Splits(trees[0])
+	keys := []string{"B$C$D", "B", "C", "D", "C$D"}
+	for _, k := range keys {
+		if _, ok := sp[k]; !ok {
+			t.Errorf("split %q missing\n", k)
+		}
+	}
+	if len(sp) != len(keys) {
+		t.Errorf("splits: %v\n", sp)
+	}
+	AnnotateClades(trees[0], rooted, len(trees), false)
+	nw := trees[0].String()
+	if nw != "((A,B)50,(C,D)100);" {
+		t.Errorf("annotated tree: %s\n", nw)
+	}
+	dmat := func() *dist.DistMat {
+		dm := dist.NewDistMat(4)
+		copy(dm.Names, []string{"A", "B", "C", "D"})
+		d := [][]float64{{0, 3, 3, 4}, {3, 0, 4, 5},
+			{3, 4, 0, 3}, {4, 5, 3, 0}}
+		for i := range d {
+			copy(dm.Matrix[i], d[i])
+		}
+		return dm
+	}
+	nw = Nj(dmat(), false, nil).String()
+	if nw != "(C:1,D:2,(A:1,B:2):1);" {
+		t.Errorf("nj tree: %s\n", nw)
+	}
+	nw = Upgma(dmat(), false, nil).String()
+	if nw != "((A:1.5,B:1.5):0.5,(C:1.5,D:1.5):0.5);" {
+		t.Errorf("upgma tree: %s\n", nw)
+	}
+	h1 := HarmonicNumber(4, 1)
+	h2 := HarmonicNumber(4, 2)
+	if math.Abs(h1-25.0/12.0) > 1e-12 ||
+		math.Abs(h2-205.0/144.0) > 1e-12 {
+		t.Errorf("harmonic numbers: %g, %g\n", h1, h2)
+	}
+	ks := []float64{1, 2, 3, 4, 5}
+	lambda, k := KarlinAltschul(ks, 10, 20)
+	u := 3.0 - euler/lambda
+	e := EValue(u, lambda, k, 10, 20)
+	b := BitScore(u, lambda, k)
+	if math.Abs(e-1) > 1e-12 ||
+		math.Abs(200*math.Pow(2, -b)-1) > 1e-12 {
+		t.Errorf("E-value: %g; bit score: %g\n", e, b)
+	}
+	z := ZScore(3+math.Sqrt(2.5), ks)
+	if math.Abs(z-1) > 1e-12 {
+		t.Errorf("z-score: %g\n", z)
+	}
+	q := fasta.NewSequence("q", []byte("AACGT"))
+	sub := fasta.NewSequence("s", []byte("ACGTT"))
+	count := func(q, s *fasta.Sequence) float64 {
+		return float64(bytes.Count(s.Data(), []byte("T")))
+	}
+	rn := rand.New(rand.NewSource(3))
+	ks = ShuffledScores(q, sub, 3, rn, count)
+	if len(ks) != 3 || ks[0] != 2 || ks[2] != 2 ||
+		string(sub.Data()) != "ACGTT" {
+		t.Errorf("shuffled scores: %v\n", ks)
+	}
+	svg := NewSVG(100, 100, 0, 1, 0, 1)
+	svg.Line(0, 0, 1, 1, "", 1)
+	svg.Text(0.5, 0.5, "a<b", "c", 90, 0, 0.5)
+	ws := "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n" +
+		"<svg xmlns=\"http://www.w3.org/2000/svg\" " +
+		"width=\"100\" height=\"100\" viewBox=\"0 0 100 100\" " +
+		"font-family=\"sans-serif\" font-size=\"12\">\n" +
+		"<rect width=\"100%\" height=\"100%\" fill=\"white\"/>\n" +
+		"<line x1=\"10.00\" y1=\"90.00\" x2=\"90.00\" y2=\"10.00\" " +
+		"stroke=\"black\" stroke-width=\"1\" " +
+		"stroke-linecap=\"round\"/>\n" +
+		"<text x=\"50.00\" y=\"50.00\" text-anchor=\"middle\" " +
+		"dominant-baseline=\"central\" dx=\"0em\" dy=\"-0.5em\" " +
+		"transform=\"rotate(-90 50.00 50.00)\" " +
+		"xml:space=\"preserve\">a&lt;b</text>\n" +
+		"</svg>\n"
+	if svg.String() != ws {
+		t.Errorf("get:\n%s\nwant:\n%s\n", svg, ws)
+	}
 }
@@ -41,10 +41,7 @@ func main() {
 		g := EulerMascheroni
 		S = t * (g + (1-g)/float64(n-1) + math.Log(float64(n-1)))
 	} else {
-		var h float64
-		for i := 1; i < n; i++ {
-			h += 1 / float64(i)
-		}
+		h := util.HarmonicNumber(n-1, 1)
 		S = t * h
 	}
 	fmt.Printf("S = %.8g\n", S)